@@ -0,0 +1,74 @@
+package gogpt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// accessTokenClaims are the claims of the payload of a JWT access token used by GoGPT
+type accessTokenClaims struct {
+	Expires json.Number `json:"exp"`
+}
+
+// accessTokenExpiry returns the expiration time decoded from the exp claim of the given JWT access token. It returns a
+// zero time.Time if the token has no exp claim, and an error if the token is not a JWT
+func accessTokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("the access token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can not decode the payload of the access token: %w", err)
+	}
+	var claims accessTokenClaims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can not unmarshal the claims of the access token: %w", err)
+	}
+	if isEmpty(claims.Expires.String()) {
+		return time.Time{}, nil
+	}
+	expires, err := claims.Expires.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid exp claim in the access token: %w", err)
+	}
+	return time.Unix(int64(expires), 0), nil
+}
+
+// NewFromAccessToken creates a new instance of GoGPT using only the given access token, without a browser. It is
+// equivalent to NewFromAccessTokenContext with context.Background()
+func NewFromAccessToken(token string, options Options) (GoGPT, error) {
+	return NewFromAccessTokenContext(context.Background(), token, options)
+}
+
+// NewFromAccessTokenContext creates a new instance of GoGPT using only the given access token, without a browser. The
+// Authenticator of the given Options is replaced by a TokenAuthenticator. As there is no session token, the session
+// endpoint is never called: the token is only validated by getting the account information from the accounts/check
+// endpoint, so the returned instance is already logged in. If the token is a JWT, its expiration time is used to
+// expire the session, and a TokenExpiredError is returned once it is expired
+func NewFromAccessTokenContext(ctx context.Context, token string, options Options) (GoGPT, error) {
+	if isEmpty(token) {
+		return nil, errors.New("the access token should be provided")
+	}
+	expires, err := accessTokenExpiry(token)
+	if err == nil && !expires.IsZero() && !expires.After(time.Now()) {
+		return nil, &TokenExpiredError{ExpiresAt: expires}
+	}
+	options.Authenticator = &TokenAuthenticator{AccessToken: token}
+	g, err := New(options)
+	if err != nil {
+		return nil, err
+	}
+	err = g.LoginContext(ctx, "", "")
+	if err != nil {
+		_ = g.Close()
+		return nil, err
+	}
+	return g, nil
+}
@@ -0,0 +1,87 @@
+package gogpt_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Makepad-fr/gogpt"
+	"github.com/Makepad-fr/gogpt/gogpttest"
+	"testing"
+	"time"
+)
+
+// newJWT returns an unsigned JWT access token expiring at the given time
+func newJWT(expires time.Time) string {
+	payload := fmt.Sprintf(`{"exp":%d}`, expires.Unix())
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+}
+
+func TestNewFromAccessToken(t *testing.T) {
+	srv := newTestServer(t)
+	gpt, err := gogpt.NewFromAccessToken(gogpttest.DefaultAccessToken, testOptions(srv))
+	if err != nil {
+		t.Fatalf("NewFromAccessToken returned an error: %v", err)
+	}
+	defer gpt.Close()
+	if _, err := gpt.Models(); err != nil {
+		t.Errorf("Models returned an error: %v", err)
+	}
+	if got := countRequests(srv, gogpttest.EndpointAccountsCheck); got != 1 {
+		t.Errorf("%d requests on the accounts/check endpoint, want 1", got)
+	}
+	if got := countRequests(srv, gogpttest.EndpointSession); got != 0 {
+		t.Errorf("%d requests on the session endpoint, want none", got)
+	}
+}
+
+func TestNewFromAccessTokenRejectsAnExpiredToken(t *testing.T) {
+	srv := newTestServer(t)
+	expires := time.Now().Add(-time.Hour)
+	_, err := gogpt.NewFromAccessToken(newJWT(expires), testOptions(srv))
+	if !errors.Is(err, gogpt.ErrAccessTokenExpired) {
+		t.Fatalf("NewFromAccessToken returned %v, want ErrAccessTokenExpired", err)
+	}
+	var expiredError *gogpt.TokenExpiredError
+	if !errors.As(err, &expiredError) || expiredError.ExpiresAt.Unix() != expires.Unix() {
+		t.Errorf("NewFromAccessToken returned %v, want a TokenExpiredError expiring at %s", err, expires)
+	}
+	if got := len(srv.Requests()); got != 0 {
+		t.Errorf("%d requests sent with an expired token, want none", got)
+	}
+}
+
+func TestNewFromAccessTokenRejectsAnUnknownToken(t *testing.T) {
+	srv := newTestServer(t)
+	_, err := gogpt.NewFromAccessToken("unknown-access-token", testOptions(srv))
+	if !errors.Is(err, gogpt.ErrUnauthorized) {
+		t.Errorf("NewFromAccessToken returned %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestRequestsFailOnceTheAccessTokenIsExpired(t *testing.T) {
+	srv := newTestServer(t)
+	expires := time.Now().Add(2 * time.Second)
+	token := newJWT(expires)
+	srv.SetSession(gogpt.Session{AccessToken: token})
+	options := testOptions(srv)
+	options.SessionRefresh.Margin = time.Millisecond
+	gpt, err := gogpt.NewFromAccessToken(token, options)
+	if err != nil {
+		t.Fatalf("NewFromAccessToken returned an error: %v", err)
+	}
+	defer gpt.Close()
+	if _, err := gpt.Models(); err != nil {
+		t.Fatalf("Models returned an error before the expiration: %v", err)
+	}
+
+	// The exp claim has a precision of a second
+	time.Sleep(time.Until(time.Unix(expires.Unix(), 0)) + 100*time.Millisecond)
+	_, err = gpt.Models()
+	if !errors.Is(err, gogpt.ErrAccessTokenExpired) || !errors.Is(err, gogpt.ErrUnauthorized) {
+		t.Fatalf("Models returned %v after the expiration, want ErrAccessTokenExpired", err)
+	}
+	var expiredError *gogpt.TokenExpiredError
+	if !errors.As(err, &expiredError) {
+		t.Errorf("Models returned %v, want a TokenExpiredError", err)
+	}
+}
@@ -0,0 +1,128 @@
+package gogpt
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+)
+
+// sessionTokenCookieName is the name of the cookie containing the session token of a ChatGPT account
+const sessionTokenCookieName = "__Secure-next-auth.session-token"
+
+// Authenticator provides the credentials used by the HTTP requests sent to ChatGPT
+type Authenticator interface {
+	// Login logs in to the ChatGPT account with the given username and password
+	Login(ctx context.Context, username, password string) error
+	// Cookies returns fresh cookies to use for the requests sent to the given url
+	Cookies(ctx context.Context, u string) ([]*http.Cookie, error)
+	// Session returns the current Session. sessionURL is the URL of the session endpoint and the given http.Client
+	// sends the cookies returned by Cookies
+	Session(ctx context.Context, client *http.Client, sessionURL string) (*Session, error)
+	// Close releases the resources used by the Authenticator
+	Close() error
+}
+
+// TokenAuthenticator is an Authenticator which does not need a browser. It uses either an access token, or a session
+// token which is used to get a fresh access token. As it can not log in, its Login method ignores the given username
+// and password and can be called with empty values to initialise the session of a GoGPT instance
+type TokenAuthenticator struct {
+	// AccessToken is the access token used in the authorization header of the requests
+	AccessToken string
+	// SessionToken is the value of the session token cookie of a logged-in ChatGPT account. If it is set, it is used
+	// to get the session and the access token from the session endpoint
+	SessionToken string
+	logger       *zap.Logger
+}
+
+// Login verifies that the current TokenAuthenticator has either an access token or a session token
+func (t *TokenAuthenticator) Login(_ context.Context, _, _ string) error {
+	if isEmpty(t.AccessToken) && isEmpty(t.SessionToken) {
+		return errors.New("either the access token or the session token should be provided")
+	}
+	return nil
+}
+
+// Cookies returns the session token cookie if the session token is provided
+func (t *TokenAuthenticator) Cookies(_ context.Context, _ string) ([]*http.Cookie, error) {
+	if isEmpty(t.SessionToken) {
+		return []*http.Cookie{}, nil
+	}
+	return []*http.Cookie{
+		{
+			Name:     sessionTokenCookieName,
+			Value:    t.SessionToken,
+			Path:     "/",
+			Secure:   true,
+			HttpOnly: true,
+		},
+	}, nil
+}
+
+// Session returns the session from the session endpoint if the session token is provided. Otherwise, it returns a
+// session containing only the access token, which expires with the access token if it is a JWT. In this case, the
+// session endpoint is not called, so the access token is not validated by this method. It returns a TokenExpiredError
+// if the access token is expired
+func (t *TokenAuthenticator) Session(ctx context.Context, client *http.Client, sessionURL string) (*Session, error) {
+	if !isEmpty(t.SessionToken) {
+		return fetchSession(ctx, client, sessionURL, t.logger)
+	}
+	expires, err := accessTokenExpiry(t.AccessToken)
+	if err != nil || expires.IsZero() {
+		return &Session{AccessToken: t.AccessToken}, nil
+	}
+	if !expires.After(time.Now()) {
+		return nil, &TokenExpiredError{ExpiresAt: expires}
+	}
+	return &Session{
+		AccessToken: t.AccessToken,
+		Expires:     expires.UTC().Format(sessionExpirationTimeLayout),
+	}, nil
+}
+
+// setLogger sets the zap.Logger used by the current TokenAuthenticator. It is called by New with the logger of the
+// GoGPT instance
+func (t *TokenAuthenticator) setLogger(l *zap.Logger) {
+	t.logger = l
+}
+
+// Close does nothing as the TokenAuthenticator does not use any resources
+func (t *TokenAuthenticator) Close() error {
+	return nil
+}
+
+// fetchSession gets the current session from the session endpoint identified by sessionURL using the given http.Client.
+// It returns an error if something goes wrong while unmarshalling the api response. A nil logger disables logging
+func fetchSession(ctx context.Context, client *http.Client, sessionURL string, logger *zap.Logger) (*Session, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	logger = logger.With(zap.String("endpoint", sessionURL))
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, sessionURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read the response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, http.MethodGet, sessionURL, body)
+	}
+	s, err := unmarshalGPTSessionResponseJSON(body)
+	if err != nil {
+		logger.Error("Error while unmarshalling session response", zap.Int("status-code", resp.StatusCode), zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("Session received", zap.String("expires", s.Expires), zap.Bool("has-access-token", !isEmpty(s.AccessToken)))
+	return s, nil
+}
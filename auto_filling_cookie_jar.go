@@ -1,43 +1,87 @@
 package gogpt
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"sync"
 	"time"
 )
 
-type httpCookieSupplier func() ([]*http.Cookie, error)
+type httpCookieSupplier func(ctx context.Context) ([]*http.Cookie, error)
 
-// autoFillingCookieJar embeds *cookiejar.Jar and adds a custom method that supplies fresh cookies
+// autoFillingCookieJar embeds *cookiejar.Jar and adds a custom method that supplies fresh cookies. It is safe for
+// concurrent use
 type autoFillingCookieJar struct {
 	*cookiejar.Jar
 	u                 *url.URL
 	newCookieSupplier httpCookieSupplier
+	refresh           singleFlight
+	mu                sync.Mutex
+	// expires is the earliest expiration time of the supplied cookies, or a zero time.Time if they are all session
+	// cookies. The jar does not return the expiration time of its cookies, so it is tracked when they are set
+	expires time.Time
 }
 
-// setExpiredCookies checks for expired cookies and sets new ones using newCookieSupplier function
-func (c *autoFillingCookieJar) setExpiredCookies() error {
+// setExpiredCookies checks for cookies which are expired, or expire in less than the given margin, and sets new ones
+// using newCookieSupplier function. The concurrent calls share the same call to newCookieSupplier
+func (c *autoFillingCookieJar) setExpiredCookies(ctx context.Context, margin time.Duration) error {
 	if c.newCookieSupplier == nil {
 		return errors.New("NewCookiesSupplier is empty")
 	}
+	if !c.hasExpiredCookies(margin) {
+		return nil
+	}
+	return c.renewCookies(ctx)
+}
 
-	cookies := c.Cookies(c.u)
+// renewCookies sets new cookies using newCookieSupplier function, even if the current cookies are not expired. The
+// concurrent calls share the same call to newCookieSupplier
+func (c *autoFillingCookieJar) renewCookies(ctx context.Context) error {
+	if c.newCookieSupplier == nil {
+		return errors.New("NewCookiesSupplier is empty")
+	}
+	return c.refresh.do(ctx, func() error {
+		newCookies, err := c.newCookieSupplier(ctx)
+		if err != nil {
+			return err
+		}
+		c.setSuppliedCookies(newCookies)
+		return nil
+	})
+}
+
+// setSuppliedCookies sets the given cookies returned by newCookieSupplier and keeps their earliest expiration time
+func (c *autoFillingCookieJar) setSuppliedCookies(cookies []*http.Cookie) {
+	now := time.Now()
+	var expires time.Time
 	for _, cookie := range cookies {
-		if cookie.Expires.Before(time.Now()) {
-			newCookies, err := c.newCookieSupplier()
-			if err != nil {
-				return err
-			}
-			c.SetCookies(c.u, newCookies)
+		cookieExpires := cookie.Expires
+		if cookie.MaxAge > 0 {
+			cookieExpires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+		if !cookieExpires.IsZero() && (expires.IsZero() || cookieExpires.Before(expires)) {
+			expires = cookieExpires
 		}
 	}
-	return nil
+	c.SetCookies(c.u, cookies)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expires = expires
+}
+
+// hasExpiredCookies returns true if one of the cookies of the current autoFillingCookieJar is expired, or expires in
+// less than the given margin. The session cookies, without expiration time, do not expire
+func (c *autoFillingCookieJar) hasExpiredCookies(margin time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.expires.IsZero() && !time.Now().Add(margin).Before(c.expires)
 }
 
 // createNewAutoFillingCookieJar creates a new cookie jar related to the given url string and with given httpCookieSupplier
-func createNewAutoFillingCookieJar(urlString string, supplier httpCookieSupplier) (*autoFillingCookieJar, error) {
+func createNewAutoFillingCookieJar(ctx context.Context, urlString string, supplier httpCookieSupplier) (*autoFillingCookieJar, error) {
 	u, err := url.Parse(urlString)
 	if err != nil {
 		return nil, err
@@ -46,7 +90,7 @@ func createNewAutoFillingCookieJar(urlString string, supplier httpCookieSupplier
 	if err != nil {
 		return nil, err
 	}
-	cookies, err := supplier()
+	cookies, err := supplier(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +99,6 @@ func createNewAutoFillingCookieJar(urlString string, supplier httpCookieSupplier
 		newCookieSupplier: supplier,
 		u:                 u,
 	}
-	cj.SetCookies(cj.u, cookies)
+	cj.setSuppliedCookies(cookies)
 	return cj, nil
 }
@@ -0,0 +1,66 @@
+package gogpt
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// countingCookieSupplier returns a httpCookieSupplier returning a cookie expiring after the given duration, and the
+// pointer to the number of calls
+func countingCookieSupplier(expiresIn time.Duration) (httpCookieSupplier, *int) {
+	calls := 0
+	return func(ctx context.Context) ([]*http.Cookie, error) {
+		calls++
+		cookie := &http.Cookie{Name: sessionTokenCookieName, Value: "token", Path: "/"}
+		if expiresIn != 0 {
+			cookie.Expires = time.Now().Add(expiresIn)
+		}
+		return []*http.Cookie{cookie}, nil
+	}, &calls
+}
+
+func TestAutoFillingCookieJarRenewsTheCookiesWithinTheMargin(t *testing.T) {
+	ctx := context.Background()
+	supplier, calls := countingCookieSupplier(time.Hour)
+	jar, err := createNewAutoFillingCookieJar(ctx, "https://chat.openai.com", supplier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := jar.setExpiredCookies(ctx, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("%d calls to the supplier with cookies expiring after the margin, want 1", *calls)
+	}
+	if err := jar.setExpiredCookies(ctx, 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("%d calls to the supplier with cookies expiring within the margin, want 2", *calls)
+	}
+}
+
+func TestAutoFillingCookieJarDoesNotRenewTheSessionCookies(t *testing.T) {
+	ctx := context.Background()
+	supplier, calls := countingCookieSupplier(0)
+	jar, err := createNewAutoFillingCookieJar(ctx, "https://chat.openai.com", supplier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jar.setExpiredCookies(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 1 {
+		t.Errorf("%d calls to the supplier with session cookies, want 1", *calls)
+	}
+	if err := jar.renewCookies(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("%d calls to the supplier after renewCookies, want 2", *calls)
+	}
+}
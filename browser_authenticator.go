@@ -0,0 +1,486 @@
+package gogpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/playwright-community/playwright-go"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// browserAuthenticator is the default Authenticator. It uses a playwright browser to log in to the ChatGPT account,
+// to pass the challenges and to get the cookies used by the HTTP requests. The access to the browser is serialized so
+// that it is safe for concurrent use
+type browserAuthenticator struct {
+	mu                 sync.Mutex
+	baseURL            string
+	browserContextPath string
+	pw                 *playwright.Playwright
+	browser            playwright.Browser
+	page               playwright.Page
+	credentials        CredentialStore
+	storeStorageState  bool
+	popupPassed        bool
+	timeout            *float64
+	logger             *zap.Logger
+}
+
+// newBrowserAuthenticator launches a new playwright browser using the given Options and returns the related
+// browserAuthenticator
+func newBrowserAuthenticator(options Options, logger *zap.Logger) (*browserAuthenticator, error) {
+	contextOptions, err := newBrowserContextOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	pw, err := runPlaywright(options.Install)
+	if err != nil {
+		return nil, err
+	}
+	browser, err := launchBrowser(pw, options.Install, options.Headless)
+	if err != nil {
+		_ = pw.Stop()
+		return nil, err
+	}
+	page, err := browser.NewPage(contextOptions)
+	if err != nil {
+		_ = browser.Close()
+		_ = pw.Stop()
+		return nil, err
+	}
+	credentials := options.CredentialStore
+	if credentials == nil {
+		credentials = NewMemoryCredentialStore()
+	}
+	return &browserAuthenticator{
+		baseURL:            options.baseURL(),
+		browserContextPath: options.BrowserContextPath,
+		pw:                 pw,
+		browser:            browser,
+		page:               page,
+		credentials:        credentials,
+		storeStorageState:  options.CredentialStore != nil,
+		popupPassed:        false,
+		timeout:            options.Timeout,
+		logger:             logger,
+	}, nil
+}
+
+// launchBrowser launches Firefox using the given playwright.Playwright. It returns a BrowsersNotInstalledError if
+// Firefox is not installed with the given InstallOptions
+func launchBrowser(pw *playwright.Playwright, install InstallOptions, headless bool) (playwright.Browser, error) {
+	browser, err := pw.Firefox.Launch(playwright.BrowserTypeLaunchOptions{Headless: &headless})
+	if err != nil {
+		if isBrowserNotInstalledError(err) {
+			return nil, &BrowsersNotInstalledError{DriverDirectory: install.driverDirectory(), Err: err}
+		}
+		return nil, err
+	}
+	return browser, nil
+}
+
+// newBrowserContextOptions returns the playwright.BrowserNewContextOptions loading the storage state from the
+// CredentialStore of the given Options if it contains one, or from the BrowserContextPath if the file exists
+func newBrowserContextOptions(options Options) (playwright.BrowserNewContextOptions, error) {
+	if options.CredentialStore != nil {
+		storageState, err := options.CredentialStore.Load(CredentialKeyStorageState)
+		if err == nil {
+			var state playwright.BrowserNewContextOptionsStorageState
+			if err := json.Unmarshal(storageState, &state); err != nil {
+				return playwright.BrowserNewContextOptions{}, err
+			}
+			return playwright.BrowserNewContextOptions{StorageState: &state}, nil
+		}
+		if !errors.Is(err, ErrCredentialNotFound) {
+			return playwright.BrowserNewContextOptions{}, err
+		}
+	}
+	s, err := os.Stat(options.BrowserContextPath)
+	if err != nil || s.IsDir() {
+		return playwright.BrowserNewContextOptions{}, nil
+	}
+	return playwright.BrowserNewContextOptions{StorageStatePath: &options.BrowserContextPath}, nil
+}
+
+// Login logs in to the ChatGPT account with the given username and password using the browser
+func (b *browserAuthenticator) Login(ctx context.Context, username, password string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if isEmpty(username) && isEmpty(password) {
+		storedUsername, storedPassword, err := b.storedCredentials()
+		if err == nil {
+			username, password = storedUsername, storedPassword
+		} else if !errors.Is(err, ErrCredentialNotFound) {
+			return err
+		}
+	}
+	return b.internalLogin(ctx, username, password)
+}
+
+// Cookies returns the cookies of the browser for the given url string passed in parameters. If the user needs to be
+// logged in, it logs in using the username and password used in the last successful login
+func (b *browserAuthenticator) Cookies(ctx context.Context, u string) ([]*http.Cookie, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	loginNeeded, err := b.userNeedsToLogin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if loginNeeded {
+		// If user needs to log in
+		// Check if both username and password are provided
+		username, password, err := b.storedCredentials()
+		if errors.Is(err, ErrCredentialNotFound) {
+			return nil, errors.New("can generate cookies as the username or password is not provided and user needs to be logged in")
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = b.internalLogin(ctx, username, password)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// If user does not need to log in pass te pop-up dialog if applicable
+		err = b.passPopupDialog(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Get cookies for the given url string
+	cookies, err := b.page.Context().Cookies(u)
+	if err != nil {
+		return nil, err
+	}
+	// Convert playwright.BrowserContextCookiesResult to http.Cookie
+	httpCookies := playwrightCookiesToHttpCookies(cookies)
+	// Return them
+	return httpCookies, nil
+}
+
+// Session returns the current session by requesting the session endpoint with the given http.Client
+func (b *browserAuthenticator) Session(ctx context.Context, client *http.Client, sessionURL string) (*Session, error) {
+	return fetchSession(ctx, client, sessionURL, b.logger)
+}
+
+// Close closes the open page, the browser window and stops the playwright driver
+func (b *browserAuthenticator) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.page.Close()
+	if err != nil {
+		return err
+	}
+	err = b.browser.Close()
+	if err != nil {
+		return err
+	}
+	return b.pw.Stop()
+}
+
+// debug disables the default behavior of playwright which is closing browser and page once the execution is done
+func (b *browserAuthenticator) debug() {
+	b.page.WaitForTimeout(100000000000)
+}
+
+// internalLogin just handles the login with the given username and password without any side effects
+func (b *browserAuthenticator) internalLogin(ctx context.Context, username, password string) error {
+	needLogin, err := b.userNeedsToLogin(ctx)
+	if err != nil {
+		return err
+	}
+	if needLogin {
+		b.logger.Debug("User needs to login")
+		err := b.page.Click(loginButtonSelector, playwright.PageClickOptions{Timeout: playwrightTimeout(ctx, nil)})
+		if err != nil {
+			b.logger.Error("Error while clicking on login button selector")
+			return err
+		}
+		err = b.page.Fill(usernameInputSelector, username, playwright.FrameFillOptions{Timeout: playwrightTimeout(ctx, nil)})
+		if err != nil {
+			b.logger.Error("Error while filling username input")
+			return err
+		}
+		err = b.page.Click(continueButtonSelector, playwright.PageClickOptions{Timeout: playwrightTimeout(ctx, nil)})
+		if err != nil {
+			b.logger.Error("Error while clicking on continue button")
+			return err
+		}
+		err = b.page.Fill(passwordInputSelector, password, playwright.FrameFillOptions{Timeout: playwrightTimeout(ctx, nil)})
+		if err != nil {
+			b.logger.Error("Error while filling the password input")
+			return err
+		}
+		err = b.page.Click(continueButtonSelector, playwright.PageClickOptions{Timeout: playwrightTimeout(ctx, nil)})
+		if err != nil {
+			b.logger.Error("Error while clicking on continue button")
+			return err
+		}
+		err = b.page.WaitForURL(fmt.Sprintf("%s/chat", b.baseURL), playwright.FrameWaitForURLOptions{Timeout: playwrightTimeout(ctx, nil)})
+		if err != nil {
+			b.logger.Error("Error while waiting the u changes to logged in URL")
+			return err
+		}
+		err = b.saveBrowserContexts()
+		if err != nil {
+			return err
+		}
+		// Login successful save login information
+		err = b.saveCredentials(username, password)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.passPopupDialog(ctx)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// userNeedsToLogin returns true if the user needs to be logged in by navigating to the default url of ChatGPT
+func (b *browserAuthenticator) userNeedsToLogin(ctx context.Context) (bool, error) {
+	err := b.navigate(ctx)
+	if b.page.URL() == fmt.Sprintf("%s/chat", b.baseURL) {
+		b.logger.Debug("Already on the application page by the URL. No need to login")
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	challengeElement, err := b.getChallenge(ctx)
+	if err != nil {
+		b.logger.Error("Error while getting challenge element")
+		return true, err
+	}
+	if challengeElement != nil {
+		err := b.solveChallenge(ctx, challengeElement)
+		if err != nil {
+			b.logger.Error("Error while solving challenge")
+			return true, err
+		}
+		err = b.saveBrowserContexts()
+		if err != nil {
+			return true, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return true, err
+	}
+	_, err = b.page.WaitForSelector(loginPageTextSelector, playwright.PageWaitForSelectorOptions{Timeout: playwrightTimeout(ctx, b.timeout)})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return true, ctxErr
+		}
+		// TODO: Verify if there's no other error -> service unavailable or already logged in
+		b.logger.Debug("Not on the login page. No need to login")
+		return false, nil
+	}
+	return true, nil
+}
+
+// navigate goes to the baseURL of the browserAuthenticator
+func (b *browserAuthenticator) navigate(ctx context.Context) error {
+	if strings.HasPrefix(b.page.URL(), b.baseURL) {
+		b.logger.Debug("No need to navigate", zap.String("current-url", b.page.URL()))
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.logger.Debug("Navigating to the base url")
+	_, err := b.page.Goto(b.baseURL, playwright.PageGotoOptions{Timeout: playwrightTimeout(ctx, nil)})
+	if err != nil {
+		b.logger.Error("Error while navigating to the default URL")
+		return err
+	}
+	return nil
+}
+
+// getChallenge returns  a playwright.ElementHandle related to the challenge and an error if there's an error returned by navigate
+func (b *browserAuthenticator) getChallenge(ctx context.Context) (playwright.ElementHandle, error) {
+	err := b.navigate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	selector, err := b.page.WaitForSelector(challengeDivSelector, playwright.PageWaitForSelectorOptions{Timeout: playwrightTimeout(ctx, b.timeout)})
+	if err != nil {
+		return nil, nil
+	}
+	return selector, nil
+}
+
+// solveChallenge solves the challenge in the login screen
+func (b *browserAuthenticator) solveChallenge(ctx context.Context, challengeElementHandle playwright.ElementHandle) error {
+	iFrameElementHandle, err := challengeElementHandle.WaitForSelector(iframeSelector, playwright.ElementHandleWaitForSelectorOptions{Timeout: playwrightTimeout(ctx, b.timeout)})
+	if err != nil {
+		b.logger.Error("iframeSelector does not exists in challengeElementHandle")
+		return err
+	}
+
+	iFrame, err := iFrameElementHandle.ContentFrame()
+	if err != nil {
+		return err
+	}
+	locator, err := iFrame.Locator(checkboxSelector)
+	if err != nil {
+		return err
+	}
+	rto := randomTimeOut()
+	b.logger.Debug("Waiting before clicking on the checkbox", zap.Float64("timeout", rto))
+	err = sleepContext(ctx, time.Duration(rto)*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	err = locator.Click(playwright.PageClickOptions{Timeout: playwrightTimeout(ctx, nil)})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// saveBrowserContexts saves the storage state of the browser context to the CredentialStore if it is provided in the
+// Options, or to the browserContextPath with the 0600 permissions otherwise
+func (b *browserAuthenticator) saveBrowserContexts() error {
+	contexts := b.browser.Contexts()
+	if len(contexts) > 1 {
+		b.logger.Fatal("Multiple contexts contexts detected", zap.Int("length", len(contexts)))
+	}
+	var store CredentialStore
+	if b.storeStorageState {
+		store = b.credentials
+	}
+	b.logger.Debug("Updating browser context", zap.String("path", b.browserContextPath), zap.Bool("credential-store", b.storeStorageState))
+	_, err := saveStorageState(contexts[0], store, b.browserContextPath)
+	if errors.Is(err, ErrReadOnlyCredentialStore) {
+		b.logger.Debug("The browser context is not saved as the credential store is read-only")
+		return nil
+	}
+	if err != nil {
+		b.logger.Error("Something went wrong when saving the browser context", zap.String("path", b.browserContextPath))
+		return err
+	}
+	b.logger.Debug("Browser context updated", zap.String("path", b.browserContextPath))
+	return nil
+}
+
+// saveStorageState saves the storage state of the given playwright.BrowserContext to the given CredentialStore if it
+// is not nil, or to the file at the given path with the 0600 permissions otherwise. It returns the saved storage state
+func saveStorageState(browserContext playwright.BrowserContext, store CredentialStore, path string) (*playwright.StorageState, error) {
+	state, err := browserContext.StorageState()
+	if err != nil {
+		return nil, err
+	}
+	storageState, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		// The file is created with the 0600 permissions, so the cookies are never readable by the other users
+		return state, writePrivateFile(path, storageState)
+	}
+	return state, store.Save(CredentialKeyStorageState, storageState)
+}
+
+// storedCredentials returns the username and the password from the CredentialStore of the browserAuthenticator
+func (b *browserAuthenticator) storedCredentials() (string, string, error) {
+	username, err := b.credentials.Load(CredentialKeyUsername)
+	if err != nil {
+		return "", "", err
+	}
+	password, err := b.credentials.Load(CredentialKeyPassword)
+	if err != nil {
+		return "", "", err
+	}
+	return string(username), string(password), nil
+}
+
+// saveCredentials saves the given username and password to the CredentialStore of the browserAuthenticator. Nothing is
+// saved if the CredentialStore is read-only
+func (b *browserAuthenticator) saveCredentials(username, password string) error {
+	err := b.credentials.Save(CredentialKeyUsername, []byte(username))
+	if err == nil {
+		err = b.credentials.Save(CredentialKeyPassword, []byte(password))
+	}
+	if errors.Is(err, ErrReadOnlyCredentialStore) {
+		b.logger.Debug("The credentials are not saved as the credential store is read-only")
+		return nil
+	}
+	return err
+}
+
+// getPopupDialog returns the playwright.ElementHandle related to the popupDialog selected by popupDialogSelector
+// if there's no pop-up dialog it returns nil
+func (b *browserAuthenticator) getPopupDialog(ctx context.Context) playwright.ElementHandle {
+	if ctx.Err() != nil {
+		return nil
+	}
+	elementHandle, err := b.page.WaitForSelector(popupDialogSelector, playwright.PageWaitForSelectorOptions{Timeout: playwrightTimeout(ctx, b.timeout)})
+	if err != nil {
+		b.logger.Debug("Popup selector does not exists")
+		return nil
+	}
+	b.logger.Debug("Popup exists returning the element handle")
+	return elementHandle
+}
+
+// passPopupDialog closes the pop-up dialog if there's any. To avoid that it happens again and again it updates the
+// browserContext identified by browserContextPath. If something getc
+func (b *browserAuthenticator) passPopupDialog(ctx context.Context) error {
+	if b.popupPassed {
+		b.logger.Debug("Pop-up already passed no need to repass")
+		return nil
+	}
+	popupDialogElementHandler := b.getPopupDialog(ctx)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if popupDialogElementHandler == nil {
+		b.logger.Debug("There's no popup to pass")
+		b.popupPassed = true
+		// If there's nothing to pass, just return
+		return nil
+	}
+	for popupDialogElementHandler != nil {
+		last := false
+		b.logger.Debug("Waiting for next button")
+		buttonHandle, err := popupDialogElementHandler.WaitForSelector(nextButtonSelector, playwright.ElementHandleWaitForSelectorOptions{Timeout: playwrightTimeout(ctx, b.timeout)})
+		if err != nil {
+			b.logger.Debug("Next button does not exists in popup. Waiting for done button")
+			buttonHandle, err = popupDialogElementHandler.WaitForSelector(doneButtonSelector, playwright.ElementHandleWaitForSelectorOptions{Timeout: playwrightTimeout(ctx, b.timeout)})
+			if err != nil {
+				b.logger.Error("Either next button or done button should appear. Something is probably wrong")
+				return err
+			}
+			last = true
+			b.logger.Debug("Done button appeared")
+		}
+		b.logger.Debug("Will click on button")
+		err = buttonHandle.Click(playwright.ElementHandleClickOptions{Timeout: playwrightTimeout(ctx, nil)})
+		if err != nil {
+			b.logger.Error("Something went wrong while clicking on button inside of the pop-up")
+			return err
+		}
+		if last {
+			b.logger.Debug("Dialog passed")
+			b.popupPassed = true
+			break
+		}
+		b.logger.Debug("Updating popup element handler")
+		popupDialogElementHandler = b.getPopupDialog(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.logger.Debug("Updating the browser context after popup")
+	// Update the browser context once the dialog is closed
+	return b.saveBrowserContexts()
+}
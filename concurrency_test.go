@@ -0,0 +1,307 @@
+package gogpt_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Makepad-fr/gogpt"
+	"github.com/Makepad-fr/gogpt/gogpttest"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runConcurrently calls the given function from the given number of goroutines at the same time and waits for them
+func runConcurrently(t *testing.T, goroutines int, fn func() error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- fn()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent call returned an error: %v", err)
+		}
+	}
+}
+
+func TestConcurrentRequestsShareTheSessionRefresh(t *testing.T) {
+	srv := newTestServer(t)
+	session := gogpt.Session{
+		AccessToken: gogpttest.DefaultAccessToken,
+		Expires:     time.Now().Add(500 * time.Millisecond).UTC().Format(time.RFC3339Nano),
+	}
+	srv.SetSession(session)
+	// The latency makes the concurrent requests arrive while the session is being refreshed
+	srv.SetLatency(gogpttest.EndpointSession, 50*time.Millisecond)
+	options := testOptions(srv)
+	options.SessionRefresh.Margin = time.Millisecond
+	gpt, err := gogpt.New(options)
+	if err != nil {
+		t.Fatalf("New returned an error: %v", err)
+	}
+	defer gpt.Close()
+
+	// The session is initialised by the first requests
+	runConcurrently(t, 8, func() error {
+		_, err := gpt.Models()
+		return err
+	})
+	if got := countRequests(srv, gogpttest.EndpointSession); got != 1 {
+		t.Errorf("%d requests on the session endpoint after the first requests, want 1", got)
+	}
+
+	// The session is refreshed once it is expired
+	session.Expires = time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339Nano)
+	srv.SetSession(session)
+	time.Sleep(600 * time.Millisecond)
+	runConcurrently(t, 8, func() error {
+		_, err := gpt.History()
+		return err
+	})
+	if got := countRequests(srv, gogpttest.EndpointSession); got != 2 {
+		t.Errorf("%d requests on the session endpoint after the expiration, want 2", got)
+	}
+}
+
+func TestConcurrentConversations(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	runConcurrently(t, 8, func() error {
+		conversation, err := gpt.CreateConversation("hello", gogpttest.DefaultModel, nil)
+		if err != nil {
+			return err
+		}
+		_, err = gpt.SendMessage(conversation.ID, "", "again", gogpttest.DefaultModel, nil)
+		return err
+	})
+	history, err := gpt.History()
+	if err != nil {
+		t.Fatalf("History returned an error: %v", err)
+	}
+	if len(history) != 8 {
+		t.Errorf("%d conversations in the history, want 8", len(history))
+	}
+	if got := countRequests(srv, gogpttest.EndpointSession); got != 1 {
+		t.Errorf("%d requests on the session endpoint, want 1", got)
+	}
+}
+
+func TestSessionLostAndRecovered(t *testing.T) {
+	srv := newTestServer(t)
+	session := gogpt.Session{
+		AccessToken: gogpttest.DefaultAccessToken,
+		Expires:     time.Now().Add(500 * time.Millisecond).UTC().Format(time.RFC3339Nano),
+	}
+	srv.SetSession(session)
+	options := testOptions(srv)
+	options.SessionRefresh.Margin = time.Millisecond
+	var mu sync.Mutex
+	var lost []error
+	options.OnSessionLost = func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		lost = append(lost, err)
+	}
+	gpt := newLoggedInGPT(t, options)
+
+	// The session endpoint returns a session without access token once the user is logged out
+	srv.SetSession(gogpt.Session{})
+	time.Sleep(600 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := gpt.Models(); !errors.Is(err, gogpt.ErrNotLoggedIn) {
+			t.Errorf("Models returned %v with an empty session, want ErrNotLoggedIn", err)
+		}
+	}
+	mu.Lock()
+	if len(lost) != 1 || !errors.Is(lost[0], gogpt.ErrNotLoggedIn) {
+		t.Errorf("OnSessionLost called with %v, want a single ErrNotLoggedIn", lost)
+	}
+	mu.Unlock()
+	if got := gpt.Session().AccessToken; got != gogpttest.DefaultAccessToken {
+		t.Errorf("access token = %q after the empty session, want the previous one", got)
+	}
+
+	// The requests recover once the session is valid again
+	session.Expires = time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339Nano)
+	srv.SetSession(session)
+	if _, err := gpt.Models(); err != nil {
+		t.Errorf("Models returned %v after the session is restored", err)
+	}
+}
+
+func TestSessionRefreshIsNotCancelledByAnotherCaller(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetLatency(gogpttest.EndpointSession, 200*time.Millisecond)
+	options := testOptions(srv)
+	// The error of the shared refresh would be hidden by a retry
+	options.Retry.MaxAttempts = 1
+	gpt, err := gogpt.New(options)
+	if err != nil {
+		t.Fatalf("New returned an error: %v", err)
+	}
+	defer gpt.Close()
+
+	// The request with a short deadline starts the session refresh, which is joined by the second request
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	modelsErr := make(chan error, 1)
+	go func() {
+		_, err := gpt.ModelsContext(ctx)
+		modelsErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := gpt.HistoryContext(context.Background()); err != nil {
+		t.Errorf("HistoryContext returned %v, want no error", err)
+	}
+	if err := <-modelsErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ModelsContext returned %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestMaxInFlightLimitsTheConcurrentRequests(t *testing.T) {
+	srv := newTestServer(t)
+	options := testOptions(srv)
+	options.RateLimit.MaxInFlight = 1
+	gpt := newLoggedInGPT(t, options)
+	initial := gpt.Metrics()
+
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	srv.Handle(gogpttest.EndpointModels, func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(gogpt.ModelsResponse{})
+	})
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := gpt.Models()
+			done <- err
+		}()
+	}
+	<-entered
+	time.Sleep(50 * time.Millisecond)
+	if got := len(entered); got != 0 {
+		t.Errorf("%d more requests received while a request is in flight, want none", got)
+	}
+	if metrics := gpt.Metrics(); metrics.InFlight != 1 || metrics.Queued != 1 {
+		t.Errorf("metrics = %+v, want 1 request in flight and 1 queued", metrics)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("Models returned an error: %v", err)
+		}
+	}
+	metrics := gpt.Metrics()
+	if metrics.InFlight != 0 || metrics.Requests != initial.Requests+2 || metrics.Throttled != initial.Throttled+1 {
+		t.Errorf("metrics = %+v, want 2 more requests and 1 more throttled than %+v", metrics, initial)
+	}
+}
+
+func TestSessionWithoutExpirationTimeIsRefreshedPeriodically(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetSession(gogpt.Session{AccessToken: gogpttest.DefaultAccessToken})
+	options := testOptions(srv)
+	options.SessionRefresh.Interval = 200 * time.Millisecond
+	gpt := newLoggedInGPT(t, options)
+
+	for i := 0; i < 3; i++ {
+		if _, err := gpt.Models(); err != nil {
+			t.Fatalf("Models returned an error: %v", err)
+		}
+	}
+	if got := countRequests(srv, gogpttest.EndpointSession); got != 1 {
+		t.Errorf("%d requests on the session endpoint before the interval, want 1", got)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if _, err := gpt.Models(); err != nil {
+		t.Fatalf("Models returned an error: %v", err)
+	}
+	if got := countRequests(srv, gogpttest.EndpointSession); got != 2 {
+		t.Errorf("%d requests on the session endpoint after the interval, want 2", got)
+	}
+}
+
+func TestRejectedRequestRenewsTheSession(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetSession(gogpt.Session{AccessToken: gogpttest.DefaultAccessToken})
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	// The access token is rotated by the server before the refresh interval
+	srv.SetSession(gogpt.Session{AccessToken: "rotated-access-token"})
+	if _, err := gpt.Models(); err != nil {
+		t.Fatalf("Models returned %v after the rotation of the access token, want no error", err)
+	}
+	if got := gpt.Session().AccessToken; got != "rotated-access-token" {
+		t.Errorf("access token = %q, want the rotated one", got)
+	}
+	if got := countRequests(srv, gogpttest.EndpointSession); got != 2 {
+		t.Errorf("%d requests on the session endpoint, want 2", got)
+	}
+}
+
+func TestBackgroundSessionRefresh(t *testing.T) {
+	t.Cleanup(gogpt.SetMinSessionRefreshInterval(10 * time.Millisecond))
+	srv := newTestServer(t)
+	// The first token is refreshed at least a second after the login as the exp claim has a precision of a second
+	firstExpiration := time.Now().Add(4 * time.Second)
+	first := newJWT(firstExpiration)
+	srv.SetSession(gogpt.Session{AccessToken: first})
+	options := testOptions(srv)
+	options.SessionRefresh = gogpt.SessionRefreshPolicy{Background: true, Margin: 2 * time.Second}
+	refreshed := make(chan gogpt.Session, 8)
+	options.OnSessionRefreshed = func(session gogpt.Session) {
+		refreshed <- session
+	}
+	gpt := newLoggedInGPT(t, options)
+	if session := <-refreshed; session.AccessToken != first {
+		t.Fatalf("first session = %+v, want the session of the login", session)
+	}
+	requests := len(srv.Requests())
+	sessionRequests := countRequests(srv, gogpttest.EndpointSession)
+
+	// The session is refreshed before its expiration without any request of the caller. The second token is refreshed
+	// less than a second after its reception
+	second := newJWT(time.Now().Add(3 * time.Second))
+	srv.SetSession(gogpt.Session{AccessToken: second})
+	select {
+	case session := <-refreshed:
+		if session.AccessToken != second {
+			t.Fatalf("refreshed session = %+v, want the new session of the server", session)
+		}
+		if !time.Now().Before(firstExpiration) {
+			t.Errorf("session refreshed after the expiration of the previous one")
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("the session is not refreshed before its expiration")
+	}
+	if got, want := len(srv.Requests())-requests, countRequests(srv, gogpttest.EndpointSession)-sessionRequests; got != want {
+		t.Errorf("%d requests sent during the refresh, want only the %d requests on the session endpoint", got, want)
+	}
+
+	// Close stops the refresher before the next refresh
+	if err := gpt.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	sessionRequests = countRequests(srv, gogpttest.EndpointSession)
+	time.Sleep(1500 * time.Millisecond)
+	if got := countRequests(srv, gogpttest.EndpointSession); got != sessionRequests {
+		t.Errorf("%d requests on the session endpoint after Close, want none", got-sessionRequests)
+	}
+}
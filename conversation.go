@@ -3,6 +3,7 @@ package gogpt
 import (
 	"github.com/Makepad-fr/gogpt/internal"
 	"github.com/google/uuid"
+	"strings"
 )
 
 type ConversationHistoryItem struct {
@@ -18,12 +19,13 @@ func (c ConversationHistoryItem) getId() string {
 }
 
 type Conversation struct {
-	Title             string                          `json:"title"`
-	CreateTime        float64                         `json:"create_time"`
-	UpdateTime        float64                         `json:"update_time"`
-	Mapping           map[string]internal.MappingNode `json:"mapping"`
-	ModerationResults []interface{}                   `json:"moderation_results"`
-	CurrentNode       string                          `json:"current_node"`
+	ID                string                 `json:"conversation_id"`
+	Title             string                 `json:"title"`
+	CreateTime        float64                `json:"create_time"`
+	UpdateTime        float64                `json:"update_time"`
+	Mapping           map[string]MappingNode `json:"mapping"`
+	ModerationResults []interface{}          `json:"moderation_results"`
+	CurrentNode       string                 `json:"current_node"`
 }
 
 type ConversationHistoryResponse struct {
@@ -35,15 +37,48 @@ type ConversationHistoryResponse struct {
 }
 
 type ConversationResponse struct {
-	Message        internal.Message `json:"message"`
-	ConversationID string           `json:"conversation_id"`
-	Error          *string          `json:"error"`
+	Message        Message `json:"message"`
+	ConversationID string  `json:"conversation_id"`
+	Error          *string `json:"error"`
+	// Text is the cumulative text of the message received so far
+	Text string `json:"-"`
+	// Delta is the text added to the message by the current response
+	Delta string `json:"-"`
+	// ReplacedRunes is the number of runes at the end of the previously received text which are replaced by Delta.
+	// It is 0 unless the backend rewrites the end of the message
+	ReplacedRunes int `json:"-"`
+}
+
+// IsTruncated returns true if the response is the last one of a message which was stopped before its end, for
+// instance because of the length limit. The generation of such message can be continued using ContinueGeneration
+func (r ConversationResponse) IsTruncated() bool {
+	if finishDetails, ok := r.Message.Metadata["finish_details"].(map[string]interface{}); ok {
+		if finishType, ok := finishDetails["type"].(string); ok {
+			return finishType == "max_tokens"
+		}
+	}
+	return r.Message.EndTurn != nil && !*r.Message.EndTurn
 }
 
 type GenerateConversationTitleResponse struct {
 	Title string `json:"title"`
 }
 
+// SharedConversation is the information about the shared link of a conversation
+type SharedConversation struct {
+	ShareID              string `json:"share_id"`
+	ShareURL             string `json:"share_url"`
+	Title                string `json:"title"`
+	IsPublic             bool   `json:"is_public"`
+	IsVisible            bool   `json:"is_visible"`
+	IsAnonymous          bool   `json:"is_anonymous"`
+	HighlightedMessageID string `json:"highlighted_message_id"`
+}
+
+type successResponse struct {
+	Success bool `json:"success"`
+}
+
 type TextModerationResponse struct {
 	Blocked      bool   `json:"blocked"`
 	Flagged      bool   `json:"flagged"`
@@ -52,15 +87,47 @@ type TextModerationResponse struct {
 
 type conversationResponseConsumer func(event ConversationResponse)
 
-func createMessageRequestInExistingConversation(message, model, conversationUUID string, timeZoneOffset int) (*internal.NewMessageRequest, error) {
+// conversationResponseHandler handles a ConversationResponse received from the event stream. Returning an error stops
+// the handling of the event stream
+type conversationResponseHandler func(event ConversationResponse) error
+
+// stitchContinuation returns a conversationResponseHandler which passes the responses of a continuation to the given
+// handler as the continuation of the previousText
+func stitchContinuation(previousText string, handler conversationResponseHandler) conversationResponseHandler {
+	lastText := previousText
+	return func(event ConversationResponse) error {
+		if !strings.HasPrefix(event.Text, previousText) {
+			event.Text = previousText + event.Text
+		}
+		event.Delta, event.ReplacedRunes = textDelta(lastText, event.Text)
+		lastText = event.Text
+		return handler(event)
+	}
+}
+
+// handler returns the conversationResponseHandler calling the current conversationResponseConsumer
+func (c conversationResponseConsumer) handler() conversationResponseHandler {
+	return func(event ConversationResponse) error {
+		if c != nil {
+			c(event)
+		}
+		return nil
+	}
+}
+
+// createMessageRequestInExistingConversation creates a new message request for the conversation identified by
+// conversationUUID. The new message will be a child of the message identified by parentMessageUUID
+func createMessageRequestInExistingConversation(message, model, conversationUUID, parentMessageUUID string, timeZoneOffset int) (*internal.NewMessageRequest, error) {
 	messageRequest, err := createMessageRequestForNewConversation(message, model, timeZoneOffset)
 	if err != nil {
 		return nil, err
 	}
 	messageRequest.ConversationId = conversationUUID
+	messageRequest.ParentMessageID = parentMessageUUID
 	return messageRequest, nil
 }
 
+// createMessageRequestForNewConversation creates a new message request which starts a new conversation
 func createMessageRequestForNewConversation(message, model string, timeZoneOffset int) (*internal.NewMessageRequest, error) {
 	messageUUID, err := uuid.NewRandom()
 	if err != nil {
@@ -89,3 +156,35 @@ func createMessageRequestForNewConversation(message, model string, timeZoneOffse
 		ParentMessageID:   parentUUID.String(),
 	}, nil
 }
+
+// createVariantMessageRequest creates a new message request which asks for a new variant of the response to the given
+// userMessage in the conversation identified by conversationUUID. The parentMessageUUID is the id of the parent of the
+// userMessage
+func createVariantMessageRequest(userMessage internal.Message, model, conversationUUID, parentMessageUUID string, timeZoneOffset int) *internal.NewMessageRequest {
+	return &internal.NewMessageRequest{
+		Action: "variant",
+		Messages: []internal.Message{
+			{
+				ID:      userMessage.ID,
+				Author:  internal.Author{Role: userMessage.Author.Role},
+				Content: userMessage.Content,
+			},
+		},
+		Model:             model,
+		TimezoneOffsetMin: timeZoneOffset,
+		ParentMessageID:   parentMessageUUID,
+		ConversationId:    conversationUUID,
+	}
+}
+
+// createContinueMessageRequest creates a new message request which continues the generation of the truncated assistant
+// message identified by messageUUID in the conversation identified by conversationUUID
+func createContinueMessageRequest(model, conversationUUID, messageUUID string, timeZoneOffset int) *internal.NewMessageRequest {
+	return &internal.NewMessageRequest{
+		Action:            "continue",
+		Model:             model,
+		TimezoneOffsetMin: timeZoneOffset,
+		ParentMessageID:   messageUUID,
+		ConversationId:    conversationUUID,
+	}
+}
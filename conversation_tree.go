@@ -0,0 +1,109 @@
+package gogpt
+
+import "sort"
+
+// Node returns the MappingNode identified by the given nodeID in the current Conversation
+func (c *Conversation) Node(nodeID string) (*MappingNode, bool) {
+	node, ok := c.Mapping[nodeID]
+	if !ok {
+		return nil, false
+	}
+	return &node, true
+}
+
+// Root returns the root MappingNode of the current Conversation. It returns nil if the conversation has no nodes
+func (c *Conversation) Root() *MappingNode {
+	for _, node := range c.Mapping {
+		if _, hasParent := c.Mapping[node.Parent]; !hasParent {
+			root := node
+			return &root
+		}
+	}
+	return nil
+}
+
+// ActiveThread walks from the CurrentNode to the root of the current Conversation and returns the messages of the
+// visited nodes in chronological order, from the first message to the message of the CurrentNode
+func (c *Conversation) ActiveThread() []Message {
+	return c.threadTo(c.CurrentNode)
+}
+
+// Branches returns the messages of the children of the node identified by nodeID. Each returned message is the
+// beginning of a different branch of the current Conversation
+func (c *Conversation) Branches(nodeID string) []Message {
+	node, ok := c.Mapping[nodeID]
+	if !ok {
+		return nil
+	}
+	messages := make([]Message, 0, len(node.Children))
+	for _, childID := range node.Children {
+		if child, ok := c.Mapping[childID]; ok && child.Message != nil {
+			messages = append(messages, *child.Message)
+		}
+	}
+	return messages
+}
+
+// Messages returns all messages of the current Conversation, including the ones in inactive branches, in
+// chronological order
+func (c *Conversation) Messages() []Message {
+	messages := make([]Message, 0, len(c.Mapping))
+	for _, node := range c.Mapping {
+		if node.Message != nil {
+			messages = append(messages, *node.Message)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		if messages[i].CreateTime != messages[j].CreateTime {
+			return messages[i].CreateTime < messages[j].CreateTime
+		}
+		return messages[i].ID < messages[j].ID
+	})
+	return messages
+}
+
+// Leaves returns the nodes of the current Conversation which have no children. Each leaf is the end of a branch of
+// the conversation. The leaves are ordered by the creation time of their messages
+func (c *Conversation) Leaves() []MappingNode {
+	leaves := make([]MappingNode, 0)
+	for _, node := range c.Mapping {
+		if len(node.Children) == 0 {
+			leaves = append(leaves, node)
+		}
+	}
+	sort.SliceStable(leaves, func(i, j int) bool {
+		ti, tj := nodeCreateTime(leaves[i]), nodeCreateTime(leaves[j])
+		if ti != tj {
+			return ti < tj
+		}
+		return leaves[i].ID < leaves[j].ID
+	})
+	return leaves
+}
+
+// threadTo returns the messages from the root of the current Conversation to the node identified by nodeID, in
+// chronological order
+func (c *Conversation) threadTo(nodeID string) []Message {
+	var messages []Message
+	node, ok := c.Mapping[nodeID]
+	// The number of visited nodes is limited to the size of the mapping to avoid looping on an inconsistent tree
+	for visited := 0; ok && visited < len(c.Mapping); visited++ {
+		if node.Message != nil {
+			messages = append(messages, *node.Message)
+		}
+		node, ok = c.Mapping[node.Parent]
+	}
+	// Reverse the messages to have them from the root to the given node
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
+
+// nodeCreateTime returns the creation time of the message of the given MappingNode, or 0 if there's no message
+func nodeCreateTime(node MappingNode) float64 {
+	if node.Message == nil {
+		return 0
+	}
+	return node.Message.CreateTime
+}
@@ -0,0 +1,150 @@
+package gogpt_test
+
+import (
+	"github.com/Makepad-fr/gogpt"
+	"reflect"
+	"testing"
+)
+
+// conversationTree returns a conversation in which the second user message was edited, and the response to the first
+// one was regenerated:
+//
+//	root ─ system ─ user-1 ┬ assistant-1 ┬ user-2 ─ assistant-2
+//	                       │             └ user-2-edited ─ assistant-2-edited
+//	                       └ assistant-1-regenerated
+func conversationTree() gogpt.Conversation {
+	nodes := []struct {
+		id, parent, role string
+		createTime       float64
+	}{
+		{"system", "root", "system", 1},
+		{"user-1", "system", "user", 2},
+		{"assistant-1", "user-1", "assistant", 3},
+		{"user-2", "assistant-1", "user", 4},
+		{"assistant-2", "user-2", "assistant", 5},
+		{"user-2-edited", "assistant-1", "user", 6},
+		{"assistant-2-edited", "user-2-edited", "assistant", 7},
+		{"assistant-1-regenerated", "user-1", "assistant", 8},
+	}
+	conversation := gogpt.Conversation{
+		ID:          "conversation",
+		CurrentNode: "assistant-2-edited",
+		Mapping:     map[string]gogpt.MappingNode{"root": {ID: "root", Children: []string{}}},
+	}
+	for _, n := range nodes {
+		conversation.Mapping[n.id] = gogpt.MappingNode{
+			ID:       n.id,
+			Parent:   n.parent,
+			Children: []string{},
+			Message:  &gogpt.Message{ID: n.id, Author: gogpt.Author{Role: n.role}, CreateTime: n.createTime},
+		}
+		parent := conversation.Mapping[n.parent]
+		parent.Children = append(parent.Children, n.id)
+		conversation.Mapping[n.parent] = parent
+	}
+	return conversation
+}
+
+// messageIDs returns the ids of the given messages
+func messageIDs(messages []gogpt.Message) []string {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func TestConversationTree(t *testing.T) {
+	conversation := conversationTree()
+
+	if root := conversation.Root(); root == nil || root.ID != "root" {
+		t.Errorf("root = %+v, want the node without parent", root)
+	}
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{
+			name: "active thread",
+			got:  messageIDs(conversation.ActiveThread()),
+			want: []string{"system", "user-1", "assistant-1", "user-2-edited", "assistant-2-edited"},
+		},
+		{
+			name: "branches of a user message",
+			got:  messageIDs(conversation.Branches("user-1")),
+			want: []string{"assistant-1", "assistant-1-regenerated"},
+		},
+		{
+			name: "branches of a response",
+			got:  messageIDs(conversation.Branches("assistant-1")),
+			want: []string{"user-2", "user-2-edited"},
+		},
+		{
+			name: "branches of a leaf",
+			got:  messageIDs(conversation.Branches("assistant-2")),
+			want: []string{},
+		},
+		{
+			name: "messages",
+			got:  messageIDs(conversation.Messages()),
+			want: []string{
+				"system", "user-1", "assistant-1", "user-2", "assistant-2", "user-2-edited", "assistant-2-edited",
+				"assistant-1-regenerated",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.got, test.want) {
+				t.Errorf("%s = %v, want %v", test.name, test.got, test.want)
+			}
+		})
+	}
+
+	var leaves []string
+	for _, leaf := range conversation.Leaves() {
+		leaves = append(leaves, leaf.ID)
+	}
+	if want := []string{"assistant-2", "assistant-2-edited", "assistant-1-regenerated"}; !reflect.DeepEqual(leaves, want) {
+		t.Errorf("leaves = %v, want %v", leaves, want)
+	}
+}
+
+func TestConversationTreeWithInvalidNodes(t *testing.T) {
+	conversation := conversationTree()
+	if branches := conversation.Branches("unknown"); branches != nil {
+		t.Errorf("branches of an unknown node = %v, want nil", branches)
+	}
+
+	for _, currentNode := range []string{"", "unknown"} {
+		conversation.CurrentNode = currentNode
+		if thread := conversation.ActiveThread(); len(thread) != 0 {
+			t.Errorf("active thread with the current node %q = %v, want no messages", currentNode, messageIDs(thread))
+		}
+	}
+
+	// The thread stops at a node whose parent is missing
+	dangling := conversation.Mapping["user-2-edited"]
+	dangling.Parent = "deleted"
+	conversation.Mapping["user-2-edited"] = dangling
+	conversation.CurrentNode = "assistant-2-edited"
+	if got, want := messageIDs(conversation.ActiveThread()), []string{"user-2-edited", "assistant-2-edited"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("active thread with a dangling parent = %v, want %v", got, want)
+	}
+
+	// A cycle does not make the thread loop forever
+	cyclic := gogpt.Conversation{
+		CurrentNode: "a",
+		Mapping: map[string]gogpt.MappingNode{
+			"a": {ID: "a", Parent: "b", Message: &gogpt.Message{ID: "a"}},
+			"b": {ID: "b", Parent: "a", Message: &gogpt.Message{ID: "b"}},
+		},
+	}
+	if thread := cyclic.ActiveThread(); len(thread) != 2 {
+		t.Errorf("active thread of a cycle = %v, want the 2 nodes once", messageIDs(thread))
+	}
+	if root := (&gogpt.Conversation{}).Root(); root != nil {
+		t.Errorf("root of an empty conversation = %+v, want nil", root)
+	}
+}
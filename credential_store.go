@@ -0,0 +1,386 @@
+package gogpt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	// CredentialKeyUsername is the key of the username of the ChatGPT account in a CredentialStore
+	CredentialKeyUsername = "username"
+	// CredentialKeyPassword is the key of the password of the ChatGPT account in a CredentialStore
+	CredentialKeyPassword = "password"
+	// CredentialKeyStorageState is the key of the playwright storage state, containing the cookies of the browser, in
+	// a CredentialStore
+	CredentialKeyStorageState = "storage-state"
+)
+
+var (
+	// ErrCredentialNotFound is returned by a CredentialStore when there is no value for the requested key
+	ErrCredentialNotFound = errors.New("credential not found")
+	// ErrReadOnlyCredentialStore is returned by a CredentialStore which can not save or delete the values
+	ErrReadOnlyCredentialStore = errors.New("credential store is read-only")
+	// ErrInsecurePermissions is returned when a file containing credentials or keys can be accessed by other users
+	ErrInsecurePermissions = errors.New("file permissions should be 0600")
+	// ErrDecryptionFailed is returned when a credential file can not be decrypted, e.g. with a wrong passphrase
+	ErrDecryptionFailed = errors.New("can not decrypt the credentials")
+)
+
+// CredentialStore stores the credentials of a ChatGPT account, such as the password and the storage state of the
+// browser. A CredentialStore must be safe for concurrent use
+type CredentialStore interface {
+	// Load returns the value of the given key. It returns an error matching ErrCredentialNotFound if there is no value
+	Load(key string) ([]byte, error)
+	// Save saves the given value for the given key
+	Save(key string, value []byte) error
+	// Delete deletes the value of the given key. It does nothing if there is no value
+	Delete(key string) error
+}
+
+// MemoryCredentialStore is a CredentialStore keeping the credentials in memory
+type MemoryCredentialStore struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+// NewMemoryCredentialStore creates a new empty MemoryCredentialStore
+func NewMemoryCredentialStore() *MemoryCredentialStore {
+	return &MemoryCredentialStore{values: map[string][]byte{}}
+}
+
+// Load returns a copy of the value of the given key
+func (s *MemoryCredentialStore) Load(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrCredentialNotFound)
+	}
+	return bytes.Clone(value), nil
+}
+
+// Save saves a copy of the given value for the given key
+func (s *MemoryCredentialStore) Save(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = bytes.Clone(value)
+	return nil
+}
+
+// Delete deletes the value of the given key
+func (s *MemoryCredentialStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+// EnvCredentialStore is a read-only CredentialStore reading the credentials from environment variables. The name of
+// the variable of a key is the Prefix followed by the key in upper case, with the characters which are not letters or
+// digits replaced by underscores, e.g. GOGPT_PASSWORD or GOGPT_STORAGE_STATE
+type EnvCredentialStore struct {
+	// Prefix is the prefix of the names of the environment variables. It defaults to GOGPT_
+	Prefix string
+}
+
+// variableName returns the name of the environment variable related to the given key
+func (s EnvCredentialStore) variableName(key string) string {
+	prefix := s.Prefix
+	if isEmpty(prefix) {
+		prefix = "GOGPT_"
+	}
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, key)
+	return prefix + strings.ToUpper(name)
+}
+
+// Load returns the value of the environment variable related to the given key
+func (s EnvCredentialStore) Load(key string) ([]byte, error) {
+	value, ok := os.LookupEnv(s.variableName(key))
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", s.variableName(key), ErrCredentialNotFound)
+	}
+	return []byte(value), nil
+}
+
+// Save returns ErrReadOnlyCredentialStore as the environment variables are not modified
+func (s EnvCredentialStore) Save(key string, _ []byte) error {
+	return fmt.Errorf("can not save %s: %w", s.variableName(key), ErrReadOnlyCredentialStore)
+}
+
+// Delete returns ErrReadOnlyCredentialStore as the environment variables are not modified
+func (s EnvCredentialStore) Delete(key string) error {
+	return fmt.Errorf("can not delete %s: %w", s.variableName(key), ErrReadOnlyCredentialStore)
+}
+
+const (
+	// credentialFileMagic is the header of the files written by FileCredentialStore
+	credentialFileMagic = "GOGPTCS1"
+	// credentialFileSaltSize is the size of the salt used to derive the key from the passphrase
+	credentialFileSaltSize = 16
+	// credentialKeySize is the size of the AES-256 keys
+	credentialKeySize = 32
+	// pbkdf2Iterations is the number of iterations used to derive the key from the passphrase
+	pbkdf2Iterations = 600000
+)
+
+// FileCredentialStore is a CredentialStore saving the credentials in a single file encrypted with AES-GCM. The key is
+// either derived from a passphrase using PBKDF2-SHA256, or read from a key file. The file is written with the 0600
+// permissions and is not read if other users can access it
+type FileCredentialStore struct {
+	mu         sync.Mutex
+	path       string
+	passphrase []byte
+	key        []byte
+	salt       []byte
+}
+
+// NewFileCredentialStore creates a new FileCredentialStore saving the credentials to the file at the given path,
+// encrypted with a key derived from the given passphrase
+func NewFileCredentialStore(path, passphrase string) (*FileCredentialStore, error) {
+	if isEmpty(passphrase) {
+		return nil, errors.New("the passphrase of the credential store can not be empty")
+	}
+	return &FileCredentialStore{path: path, passphrase: []byte(passphrase)}, nil
+}
+
+// NewFileCredentialStoreWithKeyFile creates a new FileCredentialStore saving the credentials to the file at the given
+// path, encrypted with the key read from the file at keyFilePath. The key file contains 32 bytes, either raw or hex
+// encoded, and its permissions should be 0600. Use GenerateCredentialKeyFile to create a key file
+func NewFileCredentialStoreWithKeyFile(path, keyFilePath string) (*FileCredentialStore, error) {
+	content, err := readPrivateFile(keyFilePath)
+	if err != nil {
+		return nil, err
+	}
+	key := content
+	if trimmed := strings.TrimSpace(string(content)); len(trimmed) == hex.EncodedLen(credentialKeySize) {
+		if decoded, err := hex.DecodeString(trimmed); err == nil {
+			key = decoded
+		}
+	}
+	if len(key) != credentialKeySize {
+		return nil, fmt.Errorf("the key file %s should contain %d bytes", keyFilePath, credentialKeySize)
+	}
+	return &FileCredentialStore{path: path, key: key}, nil
+}
+
+// GenerateCredentialKeyFile writes a new random hex encoded key to the given path with the 0600 permissions. It
+// returns an error if the file already exists
+func GenerateCredentialKeyFile(path string) error {
+	key := make([]byte, credentialKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(hex.EncodeToString(key) + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Load returns the value of the given key from the credential file
+func (s *FileCredentialStore) Load(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	value, ok := values[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrCredentialNotFound)
+	}
+	return value, nil
+}
+
+// Save saves the given value for the given key in the credential file
+func (s *FileCredentialStore) Save(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return err
+	}
+	values[key] = value
+	return s.write(values)
+}
+
+// Delete deletes the value of the given key from the credential file
+func (s *FileCredentialStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := values[key]; !ok {
+		return nil
+	}
+	delete(values, key)
+	return s.write(values)
+}
+
+// encryptionKey returns the key used to encrypt the credentials with the given salt
+func (s *FileCredentialStore) encryptionKey(salt []byte) []byte {
+	if s.passphrase == nil {
+		return s.key
+	}
+	if s.key == nil || !bytes.Equal(s.salt, salt) {
+		s.key = pbkdf2SHA256(s.passphrase, salt, pbkdf2Iterations, credentialKeySize)
+		s.salt = salt
+	}
+	return s.key
+}
+
+// read reads and decrypts the credential file. It returns an empty map if the file does not exist
+func (s *FileCredentialStore) read() (map[string][]byte, error) {
+	content, err := readPrivateFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string][]byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	headerSize := len(credentialFileMagic) + credentialFileSaltSize
+	if len(content) < headerSize || string(content[:len(credentialFileMagic)]) != credentialFileMagic {
+		return nil, fmt.Errorf("%s is not a credential file: %w", s.path, ErrDecryptionFailed)
+	}
+	salt := content[len(credentialFileMagic):headerSize]
+	aead, err := newAEAD(s.encryptionKey(salt))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < headerSize+aead.NonceSize() {
+		return nil, fmt.Errorf("%s is truncated: %w", s.path, ErrDecryptionFailed)
+	}
+	nonce := content[headerSize : headerSize+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, content[headerSize+aead.NonceSize():], content[:headerSize])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, ErrDecryptionFailed)
+	}
+	values := map[string][]byte{}
+	if err := json.Unmarshal(plaintext, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// write encrypts the given values and writes them to the credential file with the 0600 permissions
+func (s *FileCredentialStore) write(values map[string][]byte) error {
+	plaintext, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	salt := s.salt
+	if salt == nil {
+		salt = make([]byte, credentialFileSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+	}
+	aead, err := newAEAD(s.encryptionKey(salt))
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	header := append([]byte(credentialFileMagic), salt...)
+	ciphertext := aead.Seal(nil, nonce, plaintext, header)
+	content := make([]byte, 0, len(header)+len(nonce)+len(ciphertext))
+	content = append(append(append(content, header...), nonce...), ciphertext...)
+	return writePrivateFile(s.path, content)
+}
+
+// newAEAD creates an AES-GCM cipher.AEAD with the given key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readPrivateFile reads the file at the given path. It returns an error matching ErrInsecurePermissions if other
+// users can access the file
+func readPrivateFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s has the permissions %04o: %w", path, info.Mode().Perm(), ErrInsecurePermissions)
+	}
+	return os.ReadFile(path)
+}
+
+// writePrivateFile atomically replaces the file at the given path with the given content, with the 0600 permissions
+func writePrivateFile(path string, content []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	err = file.Chmod(0600)
+	if err == nil {
+		_, err = file.Write(content)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// pbkdf2SHA256 derives a key of the given length from the given password and salt using PBKDF2 with HMAC-SHA256, as
+// defined in RFC 8018
+func pbkdf2SHA256(password, salt []byte, iterations, keyLength int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blockCount := (keyLength + prf.Size() - 1) / prf.Size()
+	key := make([]byte, 0, blockCount*prf.Size())
+	block := make([]byte, 4)
+	for i := 1; i <= blockCount; i++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(block, uint32(i))
+		prf.Write(block)
+		u := prf.Sum(nil)
+		t := bytes.Clone(u)
+		for j := 1; j < iterations; j++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for k := range t {
+				t[k] ^= u[k]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLength]
+}
@@ -0,0 +1,199 @@
+package gogpt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Test vectors of PBKDF2-HMAC-SHA256 from RFC 7914, section 11
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{
+			password:   "passwd",
+			salt:       "salt",
+			iterations: 1,
+			want: "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+				"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+		{
+			password:   "Password",
+			salt:       "NaCl",
+			iterations: 80000,
+			want: "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+				"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d",
+		},
+	}
+	for _, test := range tests {
+		got := pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iterations, 64)
+		if hex.EncodeToString(got) != test.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %x, want %s", test.password, test.salt, test.iterations, got, test.want)
+		}
+	}
+}
+
+func TestFileCredentialStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	store, err := NewFileCredentialStore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(CredentialKeyPassword, []byte("secret")); err != nil {
+		t.Fatalf("Save returned an error: %v", err)
+	}
+	if err := store.Save(CredentialKeyUsername, []byte("user@example.com")); err != nil {
+		t.Fatalf("Save returned an error: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(content, []byte("secret")) {
+		t.Error("the credential file contains the password in clear text")
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("credential file permissions = %04o, want 0600", info.Mode().Perm())
+		}
+	}
+
+	// A new store with the same passphrase reads the saved values
+	reopened, err := NewFileCredentialStore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, err := reopened.Load(CredentialKeyPassword)
+	if err != nil || string(password) != "secret" {
+		t.Errorf("Load returned %q, %v, want %q", password, err, "secret")
+	}
+	if err := reopened.Delete(CredentialKeyPassword); err != nil {
+		t.Fatalf("Delete returned an error: %v", err)
+	}
+	if _, err := reopened.Load(CredentialKeyPassword); !errors.Is(err, ErrCredentialNotFound) {
+		t.Errorf("Load returned %v after Delete, want ErrCredentialNotFound", err)
+	}
+	if username, err := reopened.Load(CredentialKeyUsername); err != nil || string(username) != "user@example.com" {
+		t.Errorf("Load returned %q, %v, want the username", username, err)
+	}
+}
+
+func TestFileCredentialStoreWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	store, _ := NewFileCredentialStore(path, "passphrase")
+	if err := store.Save(CredentialKeyPassword, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	wrong, _ := NewFileCredentialStore(path, "wrong passphrase")
+	if _, err := wrong.Load(CredentialKeyPassword); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("Load returned %v with a wrong passphrase, want ErrDecryptionFailed", err)
+	}
+	if _, err := NewFileCredentialStore(path, ""); err == nil {
+		t.Error("NewFileCredentialStore accepted an empty passphrase")
+	}
+}
+
+func TestFileCredentialStoreRefusesInsecurePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the permissions are not checked on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "credentials")
+	store, _ := NewFileCredentialStore(path, "passphrase")
+	if err := store.Save(CredentialKeyPassword, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(CredentialKeyPassword); !errors.Is(err, ErrInsecurePermissions) {
+		t.Errorf("Load returned %v for a readable file, want ErrInsecurePermissions", err)
+	}
+}
+
+func TestFileCredentialStoreWithKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFilePath := filepath.Join(dir, "key")
+	if err := GenerateCredentialKeyFile(keyFilePath); err != nil {
+		t.Fatalf("GenerateCredentialKeyFile returned an error: %v", err)
+	}
+	if err := GenerateCredentialKeyFile(keyFilePath); err == nil {
+		t.Error("GenerateCredentialKeyFile replaced an existing key file")
+	}
+	path := filepath.Join(dir, "credentials")
+	store, err := NewFileCredentialStoreWithKeyFile(path, keyFilePath)
+	if err != nil {
+		t.Fatalf("NewFileCredentialStoreWithKeyFile returned an error: %v", err)
+	}
+	if err := store.Save(CredentialKeyStorageState, []byte(`{"cookies":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewFileCredentialStoreWithKeyFile(path, keyFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := reopened.Load(CredentialKeyStorageState); err != nil || string(value) != `{"cookies":[]}` {
+		t.Errorf("Load returned %q, %v, want the saved storage state", value, err)
+	}
+
+	// A raw key file is accepted as well
+	rawKeyFilePath := filepath.Join(dir, "raw-key")
+	if err := os.WriteFile(rawKeyFilePath, bytes.Repeat([]byte{1}, credentialKeySize), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileCredentialStoreWithKeyFile(path, rawKeyFilePath); err != nil {
+		t.Errorf("NewFileCredentialStoreWithKeyFile returned %v for a raw key file", err)
+	}
+	invalidKeyFilePath := filepath.Join(dir, "invalid-key")
+	if err := os.WriteFile(invalidKeyFilePath, []byte("too short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileCredentialStoreWithKeyFile(path, invalidKeyFilePath); err == nil {
+		t.Error("NewFileCredentialStoreWithKeyFile accepted a key of an invalid size")
+	}
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(keyFilePath, 0640); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewFileCredentialStoreWithKeyFile(path, keyFilePath); !errors.Is(err, ErrInsecurePermissions) {
+			t.Errorf("NewFileCredentialStoreWithKeyFile returned %v for a readable key file, want ErrInsecurePermissions", err)
+		}
+	}
+}
+
+func TestEnvCredentialStore(t *testing.T) {
+	t.Setenv("GOGPT_STORAGE_STATE", "state")
+	store := EnvCredentialStore{}
+	if value, err := store.Load(CredentialKeyStorageState); err != nil || string(value) != "state" {
+		t.Errorf("Load returned %q, %v, want %q", value, err, "state")
+	}
+	if _, err := (EnvCredentialStore{Prefix: "OTHER_"}).Load(CredentialKeyStorageState); !errors.Is(err, ErrCredentialNotFound) {
+		t.Errorf("Load returned %v for an unset variable, want ErrCredentialNotFound", err)
+	}
+	if err := store.Save(CredentialKeyPassword, []byte("secret")); !errors.Is(err, ErrReadOnlyCredentialStore) {
+		t.Errorf("Save returned %v, want ErrReadOnlyCredentialStore", err)
+	}
+}
+
+func TestMemoryCredentialStoreCopiesTheValues(t *testing.T) {
+	store := NewMemoryCredentialStore()
+	value := []byte("secret")
+	if err := store.Save(CredentialKeyPassword, value); err != nil {
+		t.Fatal(err)
+	}
+	value[0] = 'S'
+	if saved, _ := store.Load(CredentialKeyPassword); string(saved) != "secret" {
+		t.Errorf("Load returned %q, want the value at the time it was saved", saved)
+	}
+}
@@ -0,0 +1,49 @@
+package gogpt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Endpoints let you override the URLs used to communicate with ChatGPT. The empty fields are computed from the base URL
+type Endpoints struct {
+	// Session is the URL of the session endpoint. It defaults to <BaseURL>/api/auth/session
+	Session string
+	// API is the base URL of the backend API. It defaults to <BaseURL>/backend-api
+	API string
+	// Overrides maps an API endpoint, such as "conversation" or "models", to the URL used instead of <API>/<endpoint>.
+	// An override also applies to the sub paths of the endpoint, for instance the "conversation" override is used for
+	// "conversation/<id>" requests
+	Overrides map[string]string
+}
+
+// resolve returns a copy of the current Endpoints where the empty fields are computed from the given baseURL
+func (e Endpoints) resolve(baseURL string) Endpoints {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if isEmpty(e.Session) {
+		e.Session = fmt.Sprintf("%s/api/auth/session", baseURL)
+	}
+	if isEmpty(e.API) {
+		e.API = fmt.Sprintf("%s/backend-api", baseURL)
+	}
+	e.API = strings.TrimSuffix(e.API, "/")
+	return e
+}
+
+// apiURL returns the URL of the given API endpoint. The endpoint may contain sub paths and a query string
+func (e Endpoints) apiURL(endpoint string) string {
+	path, query, hasQuery := strings.Cut(endpoint, "?")
+	u := fmt.Sprintf("%s/%s", e.API, path)
+	var matchingKey string
+	for key, override := range e.Overrides {
+		key = strings.Trim(key, "/")
+		if (path == key || strings.HasPrefix(path, key+"/")) && len(key) > len(matchingKey) {
+			matchingKey = key
+			u = strings.TrimSuffix(override, "/") + strings.TrimPrefix(path, key)
+		}
+	}
+	if hasQuery {
+		u = fmt.Sprintf("%s?%s", u, query)
+	}
+	return u
+}
@@ -0,0 +1,89 @@
+package gogpt
+
+import "testing"
+
+func TestOptionsBaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"", defaultBaseURL},
+		{"https://proxy.example.com", "https://proxy.example.com"},
+		{"https://proxy.example.com/", "https://proxy.example.com"},
+		{"https://proxy.example.com/chat/", "https://proxy.example.com/chat"},
+	}
+	for _, test := range tests {
+		if got := (Options{BaseURL: test.baseURL}).baseURL(); got != test.want {
+			t.Errorf("baseURL of %q = %q, want %q", test.baseURL, got, test.want)
+		}
+	}
+}
+
+func TestEndpointsResolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		endpoints   Endpoints
+		baseURL     string
+		wantSession string
+		wantAPI     string
+	}{
+		{
+			name:        "defaults",
+			baseURL:     "https://chat.openai.com/",
+			wantSession: "https://chat.openai.com/api/auth/session",
+			wantAPI:     "https://chat.openai.com/backend-api",
+		},
+		{
+			name:        "session URL override",
+			endpoints:   Endpoints{Session: "https://auth.example.com/session"},
+			baseURL:     "https://chat.openai.com",
+			wantSession: "https://auth.example.com/session",
+			wantAPI:     "https://chat.openai.com/backend-api",
+		},
+		{
+			name:        "API root override",
+			endpoints:   Endpoints{API: "https://proxy.example.com/api/"},
+			baseURL:     "https://chat.openai.com",
+			wantSession: "https://chat.openai.com/api/auth/session",
+			wantAPI:     "https://proxy.example.com/api",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved := test.endpoints.resolve(test.baseURL)
+			if resolved.Session != test.wantSession || resolved.API != test.wantAPI {
+				t.Errorf("resolved endpoints = %+v, want the session %q and the API %q", resolved, test.wantSession, test.wantAPI)
+			}
+		})
+	}
+}
+
+func TestEndpointsAPIURL(t *testing.T) {
+	endpoints := Endpoints{
+		API: "https://proxy.example.com/api/",
+		Overrides: map[string]string{
+			"conversation":            "https://conversation.example.com/v1/",
+			"/conversation/gen_title": "https://title.example.com",
+			"models":                  "https://models.example.com/list",
+		},
+	}.resolve("https://chat.openai.com")
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"accounts/check", "https://proxy.example.com/api/accounts/check"},
+		{"conversations?offset=0&limit=100", "https://proxy.example.com/api/conversations?offset=0&limit=100"},
+		{"conversation", "https://conversation.example.com/v1"},
+		{"conversation/1234", "https://conversation.example.com/v1/1234"},
+		// The longest matching override wins
+		{"conversation/gen_title/1234", "https://title.example.com/1234"},
+		{"models?history_and_training_disabled=false", "https://models.example.com/list?history_and_training_disabled=false"},
+		// An override only matches whole path segments
+		{"models-v2", "https://proxy.example.com/api/models-v2"},
+	}
+	for _, test := range tests {
+		if got := endpoints.apiURL(test.endpoint); got != test.want {
+			t.Errorf("apiURL(%q) = %q, want %q", test.endpoint, got, test.want)
+		}
+	}
+}
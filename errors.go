@@ -0,0 +1,144 @@
+package gogpt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnauthorized is matched by the APIError returned when the access token or the session is not valid
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited is matched by the APIError returned when too many requests are sent
+	ErrRateLimited = errors.New("rate limited")
+	// ErrModelNotFound is returned when the requested model does not exist or is not available for the account
+	ErrModelNotFound = errors.New("model not found")
+	// ErrCloudflareChallenge is matched by the APIError returned when the request is blocked by a Cloudflare challenge
+	ErrCloudflareChallenge = errors.New("blocked by a cloudflare challenge")
+	// ErrAccessTokenExpired is matched by the TokenExpiredError returned when the access token is expired
+	ErrAccessTokenExpired = errors.New("access token expired")
+)
+
+// APIError is returned when a request sent to ChatGPT fails with an unexpected status code. It can be matched with
+// ErrUnauthorized, ErrRateLimited, ErrModelNotFound and ErrCloudflareChallenge using errors.Is
+type APIError struct {
+	// StatusCode is the status code of the response
+	StatusCode int
+	// Method is the HTTP method of the request
+	Method string
+	// Endpoint is the endpoint of the request
+	Endpoint string
+	// Body is the body of the response
+	Body []byte
+	// Detail is the message of the detail field of the response body, if any
+	Detail string
+	// Code is the code of the detail field of the response body, if any
+	Code string
+	// RetryAfter is the delay requested by the Retry-After header of the response, if any
+	RetryAfter time.Duration
+	// challenge is true if the response is a Cloudflare challenge
+	challenge bool
+}
+
+// apiErrorDetail is the detail field of the body of an error response. It is either a string or an object
+type apiErrorDetail struct {
+	Detail json.RawMessage `json:"detail"`
+}
+
+// newAPIError creates a new APIError from the given http.Response and its body, for the request sent with the given
+// method on the given endpoint
+func newAPIError(resp *http.Response, method, endpoint string, body []byte) *APIError {
+	apiError := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     method,
+		Endpoint:   endpoint,
+		Body:       body,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		challenge:  isCloudflareChallenge(resp, body),
+	}
+	var errorDetail apiErrorDetail
+	if json.Unmarshal(body, &errorDetail) != nil || len(errorDetail.Detail) == 0 {
+		return apiError
+	}
+	var detailMessage string
+	if json.Unmarshal(errorDetail.Detail, &detailMessage) == nil {
+		apiError.Detail = detailMessage
+		return apiError
+	}
+	var detailObject struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	}
+	if json.Unmarshal(errorDetail.Detail, &detailObject) == nil {
+		apiError.Detail = detailObject.Message
+		apiError.Code = detailObject.Code
+	}
+	return apiError
+}
+
+// isCloudflareChallenge returns true if the given http.Response and its body are a Cloudflare challenge page
+func isCloudflareChallenge(resp *http.Response, body []byte) bool {
+	if resp.Header.Get("cf-mitigated") == "challenge" {
+		return true
+	}
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	content := string(body)
+	return strings.Contains(content, "challenge-platform") || strings.Contains(content, "cf-chl") ||
+		strings.Contains(content, "Just a moment...")
+}
+
+// Error returns the description of the current APIError
+func (e *APIError) Error() string {
+	if isEmpty(e.Detail) {
+		return fmt.Sprintf("run http %s request on %s failed with status code %d", e.Method, e.Endpoint, e.StatusCode)
+	}
+	return fmt.Sprintf("run http %s request on %s failed with status code %d: %s", e.Method, e.Endpoint, e.StatusCode, e.Detail)
+}
+
+// Is returns true if the given target is the sentinel error related to the current APIError
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrCloudflareChallenge:
+		return e.challenge
+	case ErrUnauthorized:
+		return !e.challenge && (e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden)
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrModelNotFound:
+		return e.Code == "model_not_found" ||
+			(e.StatusCode == http.StatusNotFound && strings.Contains(strings.ToLower(e.Detail), "model"))
+	}
+	return false
+}
+
+// Retryable returns true if the request may succeed when it is sent again later
+func (e *APIError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return !e.challenge
+	}
+	return false
+}
+
+// TokenExpiredError is returned when the access token used without a session token is expired. It can be matched with
+// ErrAccessTokenExpired and ErrUnauthorized using errors.Is
+type TokenExpiredError struct {
+	// ExpiresAt is the expiration time of the access token
+	ExpiresAt time.Time
+}
+
+// Error returns the description of the current TokenExpiredError
+func (e *TokenExpiredError) Error() string {
+	return fmt.Sprintf("the access token expired at %s", e.ExpiresAt.Format(time.RFC3339))
+}
+
+// Is returns true if the given target is ErrAccessTokenExpired or ErrUnauthorized
+func (e *TokenExpiredError) Is(target error) bool {
+	return target == ErrAccessTokenExpired || target == ErrUnauthorized
+}
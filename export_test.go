@@ -0,0 +1,13 @@
+package gogpt
+
+import "time"
+
+// SetMinSessionRefreshInterval replaces the minimum duration between two refreshes of the background session
+// refresher during a test, and returns the function restoring the previous value
+func SetMinSessionRefreshInterval(interval time.Duration) func() {
+	previous := minSessionRefreshInterval
+	minSessionRefreshInterval = interval
+	return func() {
+		minSessionRefreshInterval = previous
+	}
+}
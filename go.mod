@@ -2,15 +2,17 @@ module github.com/Makepad-fr/gogpt
 
 go 1.20
 
-require github.com/playwright-community/playwright-go v0.2000.1
+require (
+	github.com/google/uuid v1.3.0
+	github.com/playwright-community/playwright-go v0.2000.1
+	go.uber.org/zap v1.24.0
+)
 
 require (
 	github.com/danwakefield/fnmatch v0.0.0-20160403171240-cbb64ac3d964 // indirect
 	github.com/go-stack/stack v1.8.1 // indirect
-	github.com/google/uuid v1.3.0 // indirect
 	github.com/stretchr/testify v1.8.0 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	go.uber.org/zap v1.24.0 // indirect
 	gopkg.in/square/go-jose.v2 v2.6.0 // indirect
 )
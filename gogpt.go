@@ -1,35 +1,61 @@
 package gogpt
 
 import (
-	"github.com/playwright-community/playwright-go"
+	"context"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"log"
-	"os"
+	"net/http"
+	"strings"
 )
 
-var logger *zap.Logger
-
-func init() {
-	err := playwright.Install()
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
+// GoGPT lets you use a ChatGPT account. A GoGPT instance is safe for concurrent use by multiple goroutines: the
+// session and the cookies are refreshed once for all the concurrent requests, and the access to the browser is
+// serialized
 type GoGPT interface {
 	Login(username, password string) error
-	Ask(question string, version Version)
+	LoginContext(ctx context.Context, username, password string) error
+	Ask(question string, version Version) (string, string, error)
+	AskContext(ctx context.Context, question string, version Version) (string, string, error)
 	History() ([]ConversationHistoryItem, error)
+	HistoryContext(ctx context.Context) ([]ConversationHistoryItem, error)
 	AccountInfo() UserAccountInfo
 	LoadConversation(uuid string) (*Conversation, error)
+	LoadConversationContext(ctx context.Context, uuid string) (*Conversation, error)
 	Close() error
 	NewChat()
 	Session() Session
 	Models() ([]ModelInfo, error)
+	ModelsContext(ctx context.Context) ([]ModelInfo, error)
 	Debug()
 	CreateConversation(message, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	CreateConversationContext(ctx context.Context, message, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	SendMessage(conversationID, parentMessageID, message, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	SendMessageContext(ctx context.Context, conversationID, parentMessageID, message, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	Regenerate(conversationID, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	RegenerateContext(ctx context.Context, conversationID, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	EditMessage(conversationID, messageID, newText, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	EditMessageContext(ctx context.Context, conversationID, messageID, newText, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	ContinueGeneration(conversationID, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	ContinueGenerationContext(ctx context.Context, conversationID, model string, onResponseCallback conversationResponseConsumer) (*Conversation, error)
+	RenameConversation(conversationID, title string) error
+	RenameConversationContext(ctx context.Context, conversationID, title string) error
+	ArchiveConversation(conversationID string) error
+	ArchiveConversationContext(ctx context.Context, conversationID string) error
+	DeleteConversation(conversationID string) error
+	DeleteConversationContext(ctx context.Context, conversationID string) error
+	DeleteAllConversations() error
+	DeleteAllConversationsContext(ctx context.Context) error
+	ShareConversation(conversationID string, anonymous bool) (*SharedConversation, error)
+	ShareConversationContext(ctx context.Context, conversationID string, anonymous bool) (*SharedConversation, error)
+	CreateConversationStream(ctx context.Context, message, model string) (<-chan StreamEvent, error)
+	SendMessageStream(ctx context.Context, conversationID, parentMessageID, message, model string) (<-chan StreamEvent, error)
 	GenerateTitle(conversationId, messageId string) ([]byte, error)
+	GenerateTitleContext(ctx context.Context, conversationId, messageId string) ([]byte, error)
 	Moderation(conversationId, messageId, messageText string) (*TextModerationResponse, error)
+	ModerationContext(ctx context.Context, conversationId, messageId, messageText string) (*TextModerationResponse, error)
+	Metrics() Metrics
+	ExportSession() (*SessionBundle, error)
+	ExportSessionContext(ctx context.Context) (*SessionBundle, error)
 }
 
 type Options struct {
@@ -38,62 +64,106 @@ type Options struct {
 	Debug              *bool
 	TimeZoneOffset     int
 	Timeout            *float64
+	// AutoContinue is the maximum number of times the generation of a truncated response is automatically continued
+	// when sending a message. It only applies to the non-streaming methods: CreateConversationStream and
+	// SendMessageStream never continue the generation. The generation is not continued automatically if it is 0
+	AutoContinue uint
+	// Authenticator provides the credentials used by the HTTP requests. If it is nil, a browser is launched and used
+	// to log in. Use a TokenAuthenticator to use an existing access token or session token without a browser. A custom
+	// Authenticator must be safe for concurrent use
+	Authenticator Authenticator
+	// Install is the InstallOptions used to find the playwright driver and browsers installed using InstallBrowsers
+	Install InstallOptions
+	// BaseURL is the URL of ChatGPT, used for the browser navigation and the HTTP requests. It defaults to
+	// https://chat.openai.com. It can be used to target a reverse proxy or a fake backend
+	BaseURL string
+	// Endpoints let you override the URL of the session endpoint, of the backend API or of specific API endpoints
+	Endpoints Endpoints
+	// Transport is the http.RoundTripper used by the HTTP requests. http.DefaultTransport is used if it is nil
+	Transport http.RoundTripper
+	// Logger is the zap.Logger used by the instance. If it is nil, a development logger is created when Debug is
+	// enabled and a production logger otherwise. With Go 1.21 or later, use NewSlogLogger to log through a
+	// log/slog handler
+	Logger *zap.Logger
+	// LogRedaction is the policy used to redact the sensitive data from the logs. By default, the tokens, the cookies,
+	// the passwords and the email addresses are redacted
+	LogRedaction LogRedaction
+	// Retry is the RetryPolicy applied to the idempotent requests. Its zero value uses the default policy
+	Retry RetryPolicy
+	// RateLimit defines the client-side rate limits and the maximum number of concurrent requests. There is no limit
+	// by default
+	RateLimit RateLimitOptions
+	// CredentialStore stores the username, the password and the storage state of the browser. If it is nil, the
+	// credentials are kept in memory and the storage state is saved unencrypted to BrowserContextPath
+	CredentialStore CredentialStore
+	// SessionRefresh defines when the session and the cookies are refreshed before their expiration. By default, the
+	// session is refreshed one minute before its expiration, before sending a request
+	SessionRefresh SessionRefreshPolicy
+	// OnSessionRefreshed is called with the new Session each time the session changes, including the first login. It
+	// is called from the goroutine which refreshed the session
+	OnSessionRefreshed func(Session)
+	// OnSessionLost is called with the error returned when an existing session can not be refreshed, including a
+	// session without access token which matches ErrNotLoggedIn. It is called once until the session is refreshed again
+	OnSessionLost func(error)
 }
 
 // New creates a new instance of GoGPT with given Options
 func New(options Options) (GoGPT, error) {
-	var loadFromBrowserContext bool
-	s, err := os.Stat(options.BrowserContextPath)
-	if err != nil {
-		loadFromBrowserContext = false
-	} else {
-		loadFromBrowserContext = !s.IsDir()
-	}
-	pw, err := playwright.Run()
-	if err != nil {
-		return nil, err
-	}
-	var browserContextPathPtr *string = nil
-	if loadFromBrowserContext {
-		browserContextPathPtr = &options.BrowserContextPath
-	}
-	var l *zap.Logger
 	if options.Debug != nil && *options.Debug {
-		l, err = zap.NewDevelopment()
 		options.Headless = false
-	} else {
-		l, err = zap.NewProduction()
 	}
+	l, err := options.logger()
 	if err != nil {
 		return nil, err
 	}
-	logger = l
-	browser, err := pw.Firefox.Launch(playwright.BrowserTypeLaunchOptions{Headless: &options.Headless})
-	if err != nil {
-		return nil, err
+	if !options.LogRedaction.isNoop() {
+		l = l.WithOptions(options.LogRedaction.wrapCore())
 	}
-	page, err := browser.NewPage(playwright.BrowserNewContextOptions{
-		StorageStatePath: browserContextPathPtr,
-	})
-	if err != nil {
-		return nil, err
+	l = l.With(zap.String("instance-id", uuid.NewString()))
+	authenticator := options.Authenticator
+	if authenticator == nil {
+		authenticator, err = newBrowserAuthenticator(options, l)
+		if err != nil {
+			return nil, err
+		}
+	} else if a, ok := authenticator.(interface{ setLogger(*zap.Logger) }); ok {
+		a.setLogger(l)
 	}
 
 	return &gpt{
-		browserContextPath:  options.BrowserContextPath,
-		browser:             browser,
-		page:                page,
-		session:             nil,
-		popupPassed:         false,
-		conversationHistory: newIdBasedSet[ConversationHistoryItem](100),
-		availableModels:     []string{},
-		timeZoneOffset:      options.TimeZoneOffset,
-		timeout:             options.Timeout,
+		logger:               l,
+		authenticator:        authenticator,
+		transport:            options.Transport,
+		baseURL:              options.baseURL(),
+		endpoints:            options.Endpoints.resolve(options.baseURL()),
+		session:              nil,
+		conversationHistory:  newIdBasedSet[ConversationHistoryItem](100),
+		availableModels:      []string{},
+		timeZoneOffset:       options.TimeZoneOffset,
+		autoContinue:         options.AutoContinue,
+		retryPolicy:          options.Retry.resolve(),
+		limiter:              newRequestLimiter(options.RateLimit),
+		sessionRefreshPolicy: options.SessionRefresh.resolve(),
+		onSessionRefreshed:   options.OnSessionRefreshed,
+		onSessionLost:        options.OnSessionLost,
 	}, nil
 }
 
-// DumpCookie lets session login to the ChatGPT with headless mode disabled and dumps the browser context to the given browserContextPath string passed in parameters
-func DumpCookie(browserContextPath string) error {
-	// TODO: Complete function definition
-	return nil
+// baseURL returns the BaseURL of the Options without trailing slash, or the default one if it is empty
+func (options Options) baseURL() string {
+	if isEmpty(options.BaseURL) {
+		return defaultBaseURL
+	}
+	return strings.TrimSuffix(options.BaseURL, "/")
+}
+
+// logger returns the Logger of the Options, or a new zap.Logger depending on the Debug option if it is nil
+func (options Options) logger() (*zap.Logger, error) {
+	if options.Logger != nil {
+		return options.Logger, nil
+	}
+	if options.Debug != nil && *options.Debug {
+		return zap.NewDevelopment()
+	}
+	return zap.NewProduction()
 }
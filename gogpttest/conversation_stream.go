@@ -0,0 +1,163 @@
+package gogpttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Makepad-fr/gogpt"
+	"github.com/Makepad-fr/gogpt/internal"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+)
+
+// handleSend updates the conversation targeted by the message request and streams the response of the assistant as
+// server-sent events
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request, body []byte) {
+	var request internal.NewMessageRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	conversation, userMessage, assistantMessage, err := s.prepareReply(request)
+	if err != nil {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": err.Error()})
+		return
+	}
+	conversationID, assistantMessageID := conversation.ID, assistantMessage.ID
+	text := strings.Join(assistantMessage.Content.Parts, "")
+	var prompt string
+	var userMessageCopy *gogpt.Message
+	if userMessage != nil {
+		prompt = strings.Join(userMessage.Content.Parts, "")
+		message := *userMessage
+		userMessageCopy = &message
+	}
+	responder := s.responder
+	s.mu.Unlock()
+	reply := responder(request.Action, prompt)
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	send := func(message gogpt.Message) {
+		data, _ := json.Marshal(gogpt.ConversationResponse{Message: message, ConversationID: conversationID})
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if userMessageCopy != nil && request.Action == "next" {
+		send(*userMessageCopy)
+	}
+	for _, chunk := range reply.Chunks {
+		select {
+		case <-r.Context().Done():
+			return
+		default:
+		}
+		text += chunk
+		send(s.updateAssistantMessage(conversationID, assistantMessageID, text, nil, nil))
+	}
+	endTurn := !reply.Truncated
+	finishType := "stop"
+	if reply.Truncated {
+		finishType = "max_tokens"
+	}
+	send(s.updateAssistantMessage(conversationID, assistantMessageID, text, &endTurn, map[string]interface{}{
+		"finish_details": map[string]interface{}{"type": finishType},
+	}))
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// prepareReply updates the conversation targeted by the given message request and returns it with the user message
+// and the assistant message which will contain the reply. The user message is nil when the generation is continued
+func (s *Server) prepareReply(request internal.NewMessageRequest) (*gogpt.Conversation, *gogpt.Message, *gogpt.Message, error) {
+	var conversation *gogpt.Conversation
+	parentID := request.ParentMessageID
+	if len(request.ConversationId) == 0 {
+		rootID := uuid.NewString()
+		conversation = &gogpt.Conversation{
+			ID:         uuid.NewString(),
+			Title:      "New chat",
+			CreateTime: now(),
+			Mapping:    map[string]gogpt.MappingNode{rootID: {ID: rootID, Children: []string{}}},
+		}
+		s.conversations[conversation.ID] = conversation
+		parentID = rootID
+	} else {
+		var ok bool
+		conversation, ok = s.conversations[request.ConversationId]
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("can't load conversation %s", request.ConversationId)
+		}
+	}
+	conversation.UpdateTime = now()
+	switch request.Action {
+	case "continue":
+		node, ok := conversation.Mapping[parentID]
+		if !ok || node.Message == nil || node.Message.Author.Role != "assistant" {
+			return nil, nil, nil, fmt.Errorf("can't continue message %s", parentID)
+		}
+		conversation.CurrentNode = node.ID
+		return conversation, nil, node.Message, nil
+	case "variant":
+		if len(request.Messages) == 0 {
+			return nil, nil, nil, fmt.Errorf("no message to regenerate")
+		}
+		userNode, ok := conversation.Mapping[request.Messages[0].ID]
+		if !ok || userNode.Message == nil {
+			return nil, nil, nil, fmt.Errorf("can't find message %s", request.Messages[0].ID)
+		}
+		return conversation, userNode.Message, s.addNode(conversation, userNode.ID, "assistant", ""), nil
+	default:
+		if len(request.Messages) == 0 {
+			return nil, nil, nil, fmt.Errorf("no message to send")
+		}
+		if _, ok := conversation.Mapping[parentID]; !ok {
+			return nil, nil, nil, fmt.Errorf("can't find parent message %s", parentID)
+		}
+		message := request.Messages[0]
+		userMessage := s.addNode(conversation, parentID, "user", strings.Join(message.Content.Parts, ""), message.ID)
+		return conversation, userMessage, s.addNode(conversation, userMessage.ID, "assistant", ""), nil
+	}
+}
+
+// addNode adds a new message with the given role and text as a child of the given parent, and makes it the current
+// node of the conversation. An optional id can be given, otherwise a new one is generated
+func (s *Server) addNode(conversation *gogpt.Conversation, parentID, role, text string, id ...string) *gogpt.Message {
+	messageID := uuid.NewString()
+	if len(id) > 0 && len(id[0]) > 0 {
+		messageID = id[0]
+	}
+	message := &gogpt.Message{
+		ID:         messageID,
+		Author:     gogpt.Author{Role: role},
+		CreateTime: now(),
+		Content:    gogpt.Content{ContentType: "text", Parts: []string{text}},
+	}
+	conversation.Mapping[messageID] = gogpt.MappingNode{ID: messageID, Message: message, Parent: parentID, Children: []string{}}
+	parent := conversation.Mapping[parentID]
+	parent.Children = append(parent.Children, messageID)
+	conversation.Mapping[parentID] = parent
+	conversation.CurrentNode = messageID
+	return message
+}
+
+// updateAssistantMessage updates the text of the assistant message identified by messageID and returns a copy of it
+func (s *Server) updateAssistantMessage(conversationID, messageID, text string, endTurn *bool, metadata map[string]interface{}) gogpt.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversation, ok := s.conversations[conversationID]
+	if !ok {
+		return gogpt.Message{ID: messageID, Author: gogpt.Author{Role: "assistant"}, Content: gogpt.Content{ContentType: "text", Parts: []string{text}}}
+	}
+	node := conversation.Mapping[messageID]
+	node.Message.Content.Parts = []string{text}
+	node.Message.EndTurn = endTurn
+	node.Message.Metadata = metadata
+	message := *node.Message
+	message.Content.Parts = []string{text}
+	return message
+}
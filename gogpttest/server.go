@@ -0,0 +1,585 @@
+// Package gogpttest provides a fake of the ChatGPT backend to test the code using gogpt without any network access
+// and without a browser.
+package gogpttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Makepad-fr/gogpt"
+	"github.com/Makepad-fr/gogpt/internal"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint identifies an endpoint of the fake backend
+type Endpoint string
+
+const (
+	// EndpointAny matches all endpoints
+	EndpointAny           Endpoint = ""
+	EndpointSession       Endpoint = "session"
+	EndpointModels        Endpoint = "models"
+	EndpointAccountsCheck Endpoint = "accounts/check"
+	EndpointConversations Endpoint = "conversations"
+	EndpointConversation  Endpoint = "conversation"
+	EndpointSend          Endpoint = "conversation/send"
+	EndpointGenTitle      Endpoint = "gen_title"
+	EndpointModerations   Endpoint = "moderations"
+	EndpointShare         Endpoint = "share"
+)
+
+// DefaultAccessToken is the access token returned by the session endpoint of a new Server
+const DefaultAccessToken = "gogpttest-access-token"
+
+// DefaultSessionToken is the session token accepted by the session endpoint of a new Server
+const DefaultSessionToken = "gogpttest-session-token"
+
+// DefaultModel is the slug of the model available by default on a new Server
+const DefaultModel = "text-davinci-002-render-sha"
+
+// Failure is an error response returned by the Server instead of the normal response
+type Failure struct {
+	StatusCode int
+	Body       string
+	Header     http.Header
+	// Times is the number of requests which fail. The failure is returned once if it is 0
+	Times int
+}
+
+// Reply is the response of the assistant streamed by the Server
+type Reply struct {
+	// Chunks are the parts of the response, each one is added to the message in a separate event
+	Chunks []string
+	// Truncated indicates that the response is stopped because of the length limit
+	Truncated bool
+}
+
+// Responder returns the Reply of the assistant to the given prompt. The action is either "next", "variant" or "continue"
+type Responder func(action, prompt string) Reply
+
+// RecordedRequest is a request received by the Server
+type RecordedRequest struct {
+	Endpoint Endpoint
+	Method   string
+	Path     string
+	Body     []byte
+}
+
+// Server is a fake of the ChatGPT backend based on httptest.Server. Its state and responses can be customised
+// before and during the tests. It is safe for concurrent use
+type Server struct {
+	server *httptest.Server
+
+	mu            sync.Mutex
+	session       gogpt.Session
+	sessionToken  string
+	models        []gogpt.ModelInfo
+	accountInfo   gogpt.UserAccountInfo
+	conversations map[string]*gogpt.Conversation
+	shares        map[string]*gogpt.SharedConversation
+	responder     Responder
+	handlers      map[Endpoint]http.HandlerFunc
+	failures      map[Endpoint][]Failure
+	latencies     map[Endpoint]time.Duration
+	requests      []RecordedRequest
+}
+
+// NewServer starts and returns a new Server with a logged-in session, the DefaultModel and an empty conversation
+// history. The Server should be closed once it is no longer used
+func NewServer() *Server {
+	s := &Server{
+		session: gogpt.Session{
+			User:        gogpt.User{ID: "user-gogpttest", Name: "gogpttest", Email: "gogpttest@example.com"},
+			Expires:     time.Now().Add(24 * time.Hour).UTC().Format("2006-01-02T15:04:05.999Z"),
+			AccessToken: DefaultAccessToken,
+		},
+		sessionToken: DefaultSessionToken,
+		models: []gogpt.ModelInfo{
+			{Slug: DefaultModel, MaxTokens: 4097, Title: "Default (GPT-3.5)"},
+		},
+		accountInfo: gogpt.UserAccountInfo{
+			AccountPlan: gogpt.AccountPlan{SubscriptionPlan: "chatgptfreeplan", AccountUserRole: "account-owner"},
+			UserCountry: "FR",
+		},
+		conversations: map[string]*gogpt.Conversation{},
+		shares:        map[string]*gogpt.SharedConversation{},
+		responder:     echoResponder,
+		handlers:      map[Endpoint]http.HandlerFunc{},
+		failures:      map[Endpoint][]Failure{},
+		latencies:     map[Endpoint]time.Duration{},
+	}
+	// The server uses TLS as the session token cookie is only sent over secure connections
+	s.server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// echoResponder is the default Responder which repeats the prompt
+func echoResponder(action, prompt string) Reply {
+	words := strings.SplitAfter(fmt.Sprintf("You said: %s", prompt), " ")
+	return Reply{Chunks: words}
+}
+
+// URL returns the base URL of the Server
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close shuts down the Server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns a http.Client which trusts the certificate of the Server
+func (s *Server) Client() *http.Client {
+	return s.server.Client()
+}
+
+// Transport returns a http.RoundTripper which sends all requests to the Server, whatever their host is. It can be used
+// to send the requests to the Server without changing the BaseURL
+func (s *Server) Transport() http.RoundTripper {
+	target, _ := url.Parse(s.server.URL)
+	return &rewritingTransport{target: target, transport: s.server.Client().Transport}
+}
+
+// Options returns the gogpt.Options to use with gogpt.New to send the requests to the URL of the Server without a
+// browser. The session is initialised by calling Login with empty credentials on the created instance
+func (s *Server) Options() gogpt.Options {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return gogpt.Options{
+		BaseURL:       s.server.URL,
+		Authenticator: &gogpt.TokenAuthenticator{SessionToken: s.sessionToken},
+		Transport:     s.server.Client().Transport,
+	}
+}
+
+// SetSession replaces the session returned by the session endpoint
+func (s *Server) SetSession(session gogpt.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = session
+}
+
+// SetModels replaces the available models
+func (s *Server) SetModels(models []gogpt.ModelInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models = models
+}
+
+// SetAccountInfo replaces the account information
+func (s *Server) SetAccountInfo(accountInfo gogpt.UserAccountInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accountInfo = accountInfo
+}
+
+// SetResponder replaces the Responder used to generate the responses of the assistant. The default Responder, which
+// repeats the prompt, is used if the given Responder is nil
+func (s *Server) SetResponder(responder Responder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if responder == nil {
+		responder = echoResponder
+	}
+	s.responder = responder
+}
+
+// AddConversation adds the given conversation to the history. A new ID is generated if it is empty. It returns the ID
+// of the added conversation
+func (s *Server) AddConversation(conversation gogpt.Conversation) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(conversation.ID) == 0 {
+		conversation.ID = uuid.NewString()
+	}
+	if conversation.Mapping == nil {
+		conversation.Mapping = map[string]gogpt.MappingNode{}
+	}
+	if conversation.CreateTime == 0 {
+		conversation.CreateTime = now()
+		conversation.UpdateTime = conversation.CreateTime
+	}
+	s.conversations[conversation.ID] = &conversation
+	return conversation.ID
+}
+
+// Conversation returns a copy of the conversation identified by the given id
+func (s *Server) Conversation(id string) (gogpt.Conversation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversation, ok := s.conversations[id]
+	if !ok {
+		return gogpt.Conversation{}, false
+	}
+	return copyConversation(conversation), true
+}
+
+// Handle replaces the handler of the given endpoint with the given http.HandlerFunc
+func (s *Server) Handle(endpoint Endpoint, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[endpoint] = handler
+}
+
+// InjectFailure makes the next requests on the given endpoint fail with the given Failure. Failures are returned in
+// the order they are injected. Use EndpointAny to make requests fail on any endpoint
+func (s *Server) InjectFailure(endpoint Endpoint, failure Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if failure.Times <= 0 {
+		failure.Times = 1
+	}
+	s.failures[endpoint] = append(s.failures[endpoint], failure)
+}
+
+// SetLatency delays the responses of the given endpoint by the given duration. Use EndpointAny to delay the responses
+// of all endpoints
+func (s *Server) SetLatency(endpoint Endpoint, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencies[endpoint] = latency
+}
+
+// Requests returns the requests received by the Server
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]RecordedRequest{}, s.requests...)
+}
+
+// rewritingTransport is a http.RoundTripper which sends all requests to the target URL
+type rewritingTransport struct {
+	target    *url.URL
+	transport http.RoundTripper
+}
+
+func (t *rewritingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	rewritten := request.Clone(request.Context())
+	rewritten.URL.Scheme = t.target.Scheme
+	rewritten.URL.Host = t.target.Host
+	rewritten.Host = t.target.Host
+	return t.transport.RoundTrip(rewritten)
+}
+
+// endpointOf returns the Endpoint related to the given path
+func endpointOf(method, path string) Endpoint {
+	switch {
+	case path == "/api/auth/session":
+		return EndpointSession
+	case path == "/backend-api/models":
+		return EndpointModels
+	case path == "/backend-api/accounts/check":
+		return EndpointAccountsCheck
+	case path == "/backend-api/conversations":
+		return EndpointConversations
+	case path == "/backend-api/conversation" && method == http.MethodPost:
+		return EndpointSend
+	case strings.HasPrefix(path, "/backend-api/conversation/gen_title/"):
+		return EndpointGenTitle
+	case strings.HasPrefix(path, "/backend-api/conversation/"):
+		return EndpointConversation
+	case path == "/backend-api/moderations":
+		return EndpointModerations
+	case strings.HasPrefix(path, "/backend-api/share/"):
+		return EndpointShare
+	default:
+		return Endpoint(path)
+	}
+}
+
+// serveHTTP records the request, applies the latency and the failures and dispatches the request to its handler
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := endpointOf(r.Method, r.URL.Path)
+	body, _ := readBody(r)
+	s.mu.Lock()
+	s.requests = append(s.requests, RecordedRequest{Endpoint: endpoint, Method: r.Method, Path: r.URL.RequestURI(), Body: body})
+	latency := s.latencies[endpoint] + s.latencies[EndpointAny]
+	failure := s.popFailure(endpoint)
+	handler := s.handlers[endpoint]
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failure != nil {
+		for key, values := range failure.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		w.WriteHeader(failure.StatusCode)
+		_, _ = w.Write([]byte(failure.Body))
+		return
+	}
+	if handler != nil {
+		handler(w, r)
+		return
+	}
+	if endpoint != EndpointSession && !s.isAuthorized(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"detail": "Unauthorized"})
+		return
+	}
+	switch endpoint {
+	case EndpointSession:
+		s.handleSession(w, r)
+	case EndpointModels:
+		s.mu.Lock()
+		writeJSON(w, http.StatusOK, gogpt.ModelsResponse{Models: s.models})
+		s.mu.Unlock()
+	case EndpointAccountsCheck:
+		s.mu.Lock()
+		writeJSON(w, http.StatusOK, s.accountInfo)
+		s.mu.Unlock()
+	case EndpointConversations:
+		s.handleConversations(w, r, body)
+	case EndpointSend:
+		s.handleSend(w, r, body)
+	case EndpointGenTitle:
+		s.handleGenTitle(w, r, body)
+	case EndpointConversation:
+		s.handleConversation(w, r, body)
+	case EndpointModerations:
+		writeJSON(w, http.StatusOK, gogpt.TextModerationResponse{ModerationId: uuid.NewString()})
+	case EndpointShare:
+		s.handleShare(w, r, body)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not Found"})
+	}
+}
+
+// popFailure returns the next Failure of the given endpoint, or nil if there's no failure to return
+func (s *Server) popFailure(endpoint Endpoint) *Failure {
+	for _, e := range []Endpoint{endpoint, EndpointAny} {
+		failures := s.failures[e]
+		if len(failures) == 0 {
+			continue
+		}
+		failure := failures[0]
+		failures[0].Times--
+		if failures[0].Times <= 0 {
+			s.failures[e] = failures[1:]
+		}
+		return &failure
+	}
+	return nil
+}
+
+// isAuthorized returns true if the given request has the access token of the current session
+func (s *Server) isAuthorized(r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return r.Header.Get("Authorization") == fmt.Sprintf("Bearer %s", s.session.AccessToken)
+}
+
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cookie, err := r.Cookie("__Secure-next-auth.session-token")
+	if err != nil || cookie.Value != s.sessionToken {
+		// The real backend returns an empty object when the user is not logged in
+		writeJSON(w, http.StatusOK, map[string]string{})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.session)
+}
+
+func (s *Server) handleConversations(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method == http.MethodPatch {
+		var update internal.UpdateConversationRequestBody
+		if err := json.Unmarshal(body, &update); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+			return
+		}
+		if update.IsVisible != nil && !*update.IsVisible {
+			s.conversations = map[string]*gogpt.Conversation{}
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+		return
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	conversations := s.sortedConversations()
+	items := make([]gogpt.ConversationHistoryItem, 0, limit)
+	for i := offset; i < len(conversations) && i < offset+limit; i++ {
+		items = append(items, gogpt.ConversationHistoryItem{
+			ID:         conversations[i].ID,
+			Title:      conversations[i].Title,
+			CreateTime: formatTime(conversations[i].CreateTime),
+			UpdateTime: formatTime(conversations[i].UpdateTime),
+		})
+	}
+	writeJSON(w, http.StatusOK, gogpt.ConversationHistoryResponse{
+		Items:  items,
+		Total:  len(conversations),
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// sortedConversations returns the conversations from the most recently updated to the least recently updated
+func (s *Server) sortedConversations() []*gogpt.Conversation {
+	conversations := make([]*gogpt.Conversation, 0, len(s.conversations))
+	for _, conversation := range s.conversations {
+		conversations = append(conversations, conversation)
+	}
+	sort.SliceStable(conversations, func(i, j int) bool {
+		if conversations[i].UpdateTime != conversations[j].UpdateTime {
+			return conversations[i].UpdateTime > conversations[j].UpdateTime
+		}
+		return conversations[i].ID < conversations[j].ID
+	})
+	return conversations
+}
+
+func (s *Server) handleConversation(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := strings.TrimPrefix(r.URL.Path, "/backend-api/conversation/")
+	conversation, ok := s.conversations[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Can't load conversation " + id})
+		return
+	}
+	if r.Method == http.MethodPatch {
+		var update internal.UpdateConversationRequestBody
+		if err := json.Unmarshal(body, &update); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+			return
+		}
+		if update.Title != nil {
+			conversation.Title = *update.Title
+		}
+		if (update.IsVisible != nil && !*update.IsVisible) || (update.IsArchived != nil && *update.IsArchived) {
+			delete(s.conversations, id)
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+		return
+	}
+	writeJSON(w, http.StatusOK, copyConversation(conversation))
+}
+
+func (s *Server) handleGenTitle(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := strings.TrimPrefix(r.URL.Path, "/backend-api/conversation/gen_title/")
+	conversation, ok := s.conversations[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Can't load conversation " + id})
+		return
+	}
+	var request internal.GenerateConversationTitleRequestBody
+	_ = json.Unmarshal(body, &request)
+	title := "New chat"
+	if node, ok := conversation.Mapping[request.MessageId]; ok && node.Message != nil {
+		title = strings.Join(node.Message.Content.Parts, "")
+		if len(title) > 30 {
+			title = title[:30]
+		}
+	}
+	conversation.Title = title
+	writeJSON(w, http.StatusOK, gogpt.GenerateConversationTitleResponse{Title: title})
+}
+
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.URL.Path == "/backend-api/share/create" {
+		var request internal.CreateShareRequestBody
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+			return
+		}
+		conversation, ok := s.conversations[request.ConversationId]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Can't load conversation " + request.ConversationId})
+			return
+		}
+		shareID := uuid.NewString()
+		share := &gogpt.SharedConversation{
+			ShareID:     shareID,
+			ShareURL:    fmt.Sprintf("%s/share/%s", s.server.URL, shareID),
+			Title:       conversation.Title,
+			IsAnonymous: request.IsAnonymous,
+		}
+		s.shares[shareID] = share
+		writeJSON(w, http.StatusOK, share)
+		return
+	}
+	shareID := strings.TrimPrefix(r.URL.Path, "/backend-api/share/")
+	share, ok := s.shares[shareID]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Share not found"})
+		return
+	}
+	var request internal.UpdateShareRequestBody
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	share.Title = request.Title
+	share.IsPublic = request.IsPublic
+	share.IsVisible = request.IsVisible
+	share.IsAnonymous = request.IsAnonymous
+	share.HighlightedMessageID = request.HighlightedMessageId
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// readBody reads the body of the given request
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	defer r.Body.Close()
+	return io.ReadAll(r.Body)
+}
+
+// writeJSON writes the given value as JSON with the given status code
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// now returns the current time as seconds since epoch, as used by the backend
+func now() float64 {
+	return float64(time.Now().UnixMicro()) / 1e6
+}
+
+// formatTime formats the given seconds since epoch as used in the conversation history
+func formatTime(t float64) string {
+	return time.UnixMicro(int64(t * 1e6)).UTC().Format("2006-01-02T15:04:05.999999")
+}
+
+// copyConversation returns a deep copy of the given conversation
+func copyConversation(conversation *gogpt.Conversation) gogpt.Conversation {
+	result := *conversation
+	result.Mapping = make(map[string]gogpt.MappingNode, len(conversation.Mapping))
+	for id, node := range conversation.Mapping {
+		node.Children = append([]string{}, node.Children...)
+		if node.Message != nil {
+			message := *node.Message
+			message.Content.Parts = append([]string{}, message.Content.Parts...)
+			node.Message = &message
+		}
+		result.Mapping[id] = node
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+package gogpttest_test
+
+import (
+	"encoding/json"
+	"github.com/Makepad-fr/gogpt"
+	"github.com/Makepad-fr/gogpt/gogpttest"
+	"go.uber.org/zap"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// get sends a GET request to the given path of the given Server with the default access token
+func get(t *testing.T, srv *gogpttest.Server, path string) *http.Response {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, srv.URL()+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+gogpttest.DefaultAccessToken)
+	resp, err := srv.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+	return resp
+}
+
+func TestSessionRequiresTheSessionToken(t *testing.T) {
+	srv := gogpttest.NewServer()
+	defer srv.Close()
+
+	var session gogpt.Session
+	if err := json.NewDecoder(get(t, srv, "/api/auth/session").Body).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+	if session.AccessToken != "" {
+		t.Errorf("access token = %q without the session token, want an empty session", session.AccessToken)
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, srv.URL()+"/api/auth/session", nil)
+	request.AddCookie(&http.Cookie{Name: "__Secure-next-auth.session-token", Value: gogpttest.DefaultSessionToken})
+	resp, err := srv.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+	if session.AccessToken != gogpttest.DefaultAccessToken {
+		t.Errorf("access token = %q, want %q", session.AccessToken, gogpttest.DefaultAccessToken)
+	}
+}
+
+func TestAPIRequiresTheAccessToken(t *testing.T) {
+	srv := gogpttest.NewServer()
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL() + "/backend-api/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status code = %d without access token, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	if got := get(t, srv, "/backend-api/models").StatusCode; got != http.StatusOK {
+		t.Errorf("status code = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestFailuresAreReturnedInOrder(t *testing.T) {
+	srv := gogpttest.NewServer()
+	defer srv.Close()
+	srv.InjectFailure(gogpttest.EndpointModels, gogpttest.Failure{StatusCode: http.StatusBadGateway, Times: 2})
+	srv.InjectFailure(gogpttest.EndpointAny, gogpttest.Failure{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"1"}},
+	})
+
+	want := []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK}
+	for i, statusCode := range want {
+		resp := get(t, srv, "/backend-api/models")
+		if resp.StatusCode != statusCode {
+			t.Errorf("status code of request %d = %d, want %d", i, resp.StatusCode, statusCode)
+		}
+		if statusCode == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "1" {
+			t.Errorf("Retry-After header = %q, want %q", resp.Header.Get("Retry-After"), "1")
+		}
+	}
+	if got := len(srv.Requests()); got != len(want) {
+		t.Errorf("%d recorded requests, want %d", got, len(want))
+	}
+}
+
+func TestLatencyDelaysTheResponses(t *testing.T) {
+	srv := gogpttest.NewServer()
+	defer srv.Close()
+	srv.SetLatency(gogpttest.EndpointAccountsCheck, 100*time.Millisecond)
+
+	start := time.Now()
+	get(t, srv, "/backend-api/models")
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("models endpoint responded after %s, want no latency", elapsed)
+	}
+	start = time.Now()
+	get(t, srv, "/backend-api/accounts/check")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("accounts/check endpoint responded after %s, want at least 100ms", elapsed)
+	}
+}
+
+func TestServerWorksWithGoGPT(t *testing.T) {
+	srv := gogpttest.NewServer()
+	defer srv.Close()
+	options := srv.Options()
+	options.Logger = zap.NewNop()
+	gpt, err := gogpt.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpt.Close()
+	if err := gpt.Login("", ""); err != nil {
+		t.Fatalf("Login returned an error: %v", err)
+	}
+	conversation, err := gpt.CreateConversation("hello", gogpttest.DefaultModel, nil)
+	if err != nil {
+		t.Fatalf("CreateConversation returned an error: %v", err)
+	}
+	stored, ok := srv.Conversation(conversation.ID)
+	if !ok {
+		t.Fatal("the conversation is not stored by the server")
+	}
+	thread := stored.ActiveThread()
+	if len(thread) != 2 || thread[1].Content.Parts[0] != "You said: hello" {
+		t.Errorf("active thread = %+v, want the prompt and its echo", thread)
+	}
+}
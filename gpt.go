@@ -1,151 +1,77 @@
 package gogpt
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/playwright-community/playwright-go"
+	"github.com/Makepad-fr/gogpt/internal"
 	"go.uber.org/zap"
-	"log"
 	"math"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 )
 
+// maxEmptyHistoryPages is the maximum number of pages of the conversation history which do not bring any new
+// conversation before the loading of the history stops
+const maxEmptyHistoryPages = 5
+
 type gpt struct {
 	GoGPT
-	browserContextPath  string
-	browser             playwright.Browser
-	page                playwright.Page
-	session             *Session
-	httpClient          *http.Client
-	cookieJar           *autoFillingCookieJar
-	accountInfo         *UserAccountInfo
-	username, password  *string
-	popupPassed         bool
-	conversationHistory *idBasedSet[ConversationHistoryItem]
-	availableModels     []string
-	timeZoneOffset      int
-	timeout             *float64
-}
-
-// getChallenge returns  a playwright.ElementHandle related to the challenge and an error if there's an error returned by navigate
-func (g *gpt) getChallenge() (playwright.ElementHandle, error) {
-	err := g.navigate()
-	if err != nil {
-		return nil, err
-	}
-	selector, err := g.page.WaitForSelector(challengeDivSelector, playwright.PageWaitForSelectorOptions{Timeout: g.timeout})
-	if err != nil {
-		return nil, nil
-	}
-	return selector, nil
-}
-
-// Close closes the open page and the browser window
-func (g *gpt) Close() error {
-	err := g.page.Close()
-	if err != nil {
-		return err
-	}
-	return g.browser.Close()
-}
-
-// navigate goes to the baseURL
-func (g *gpt) navigate() error {
-	if strings.HasPrefix(g.page.URL(), baseURL) {
-		logger.Debug("No need to navigate", zap.String("current-url", g.page.URL()))
-		return nil
-	}
-	logger.Debug("Navigating to the base url")
-	_, err := g.page.Goto(baseURL)
-	if err != nil {
-		logger.Error("Error while navigating to the default URL")
-		return err
-	}
-	return nil
-}
-
-// solveChallenge solves the challenge in the login screen
-func (g *gpt) solveChallenge(challengeElementHandle playwright.ElementHandle) error {
-	iFrameElementHandle, err := challengeElementHandle.WaitForSelector(iframeSelector, playwright.ElementHandleWaitForSelectorOptions{Timeout: g.timeout})
-	if err != nil {
-		logger.Error("iframeSelector does not exists in challengeElementHandle")
-		return err
-	}
-
-	iFrame, err := iFrameElementHandle.ContentFrame()
-	if err != nil {
-		return err
-	}
-	locator, err := iFrame.Locator(checkboxSelector)
-	if err != nil {
-		return err
-	}
-	rto := randomTimeOut()
-	log.Printf("Will wait for %fms\n", rto)
-	g.page.WaitForTimeout(rto)
-	err = locator.Click()
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// userNeedsToLogin returns true if the user needs to be logged in by navigating to the default url of ChatGPT
-func (g *gpt) userNeedsToLogin() (bool, error) {
-	err := g.navigate()
-	if g.page.URL() == fmt.Sprintf("%s/chat", baseURL) {
-		logger.Debug("Already on the application page by the URL. No need to login")
-		return false, nil
-	}
-	if err != nil {
-		return true, err
-	}
-	challengeElement, err := g.getChallenge()
-	if err != nil {
-		logger.Error("Error while getting challenge element")
-		return true, err
-	}
-	if challengeElement != nil {
-		err := g.solveChallenge(challengeElement)
-		if err != nil {
-			logger.Error("Error while solving challenge")
-			return true, err
-		}
-		err = g.saveBrowserContexts()
-		if err != nil {
-			return true, err
-		}
-	}
-	_, err = g.page.WaitForSelector(loginPageTextSelector, playwright.PageWaitForSelectorOptions{Timeout: g.timeout})
-	if err != nil {
-		// TODO: Verify if there's no other error -> service unavailable or already logged in
-		logger.Debug("Not on the login page. No need to login")
-		return false, nil
-	}
-	return true, nil
+	logger                 *zap.Logger
+	mu                     sync.RWMutex
+	sessionRefresh         singleFlight
+	authenticator          Authenticator
+	transport              http.RoundTripper
+	baseURL                string
+	endpoints              Endpoints
+	session                *Session
+	sessionFetchedAt       time.Time
+	httpClient             *http.Client
+	cookieJar              *autoFillingCookieJar
+	accountInfo            *UserAccountInfo
+	conversationHistory    *idBasedSet[ConversationHistoryItem]
+	availableModels        []string
+	timeZoneOffset         int
+	autoContinue           uint
+	retryPolicy            RetryPolicy
+	limiter                *requestLimiter
+	sessionRefreshPolicy   SessionRefreshPolicy
+	onSessionRefreshed     func(Session)
+	onSessionLost          func(error)
+	sessionLost            bool
+	closed                 bool
+	sessionRefresherCancel context.CancelFunc
+	sessionRefresherDone   chan struct{}
 }
 
 // Login let you log in to your ChatGPT account using given username and password
 func (g *gpt) Login(username, password string) error {
-	err := g.internalLogin(username, password)
+	return g.LoginContext(context.Background(), username, password)
+}
+
+// LoginContext let you log in to your ChatGPT account using given username and password. The given context.Context is
+// used for both the browser operations and the HTTP requests. A pending browser operation only stops at the deadline
+// of the context.Context or after the Timeout option: the cancellation of a context.Context without deadline is only
+// noticed between two browser operations
+func (g *gpt) LoginContext(ctx context.Context, username, password string) error {
+	err := g.authenticator.Login(ctx, username, password)
 	if err != nil {
 		return err
 	}
-	err = g.initCookieJarAndHttpClient()
+	err = g.initCookieJarAndHttpClient(ctx)
 	if err != nil {
 		return err
 	}
-	err = g.initSession()
+	err = g.initSession(ctx)
 	if err != nil {
 		return err
 	}
-	err = g.initUserAccountInfo()
+	err = g.initUserAccountInfo(ctx)
 	if err != nil {
 		return err
 	}
-	err = g.initAvailableModels()
+	err = g.initAvailableModels(ctx)
 	if err != nil {
 		return err
 	}
@@ -153,67 +79,116 @@ func (g *gpt) Login(username, password string) error {
 }
 
 // initAvailableModels initialises availableModels in the current gpt instance.
-func (g *gpt) initAvailableModels() error {
-	modelInfo, err := g.Models()
+func (g *gpt) initAvailableModels(ctx context.Context) error {
+	modelInfo, err := g.ModelsContext(ctx)
 	if err != nil {
 		return err
 	}
+	availableModels := make([]string, 0, len(modelInfo))
 	for _, mi := range modelInfo {
-		g.availableModels = append(g.availableModels, mi.Slug)
+		availableModels = append(availableModels, mi.Slug)
 	}
+	g.mu.Lock()
+	g.availableModels = availableModels
+	g.mu.Unlock()
 	return nil
 }
 
 // Session returns the information about the current session
 func (g *gpt) Session() Session {
-	return *g.session
+	return *g.currentSession()
 }
 
 // initUserAccountInfo initialises the account information for the current user
-func (g *gpt) initUserAccountInfo() error {
-	accountInfo, err := g.getAccountInfo()
+func (g *gpt) initUserAccountInfo(ctx context.Context) error {
+	accountInfo, err := g.getAccountInfo(ctx)
 	if err != nil {
 		return err
 	}
+	g.mu.Lock()
 	g.accountInfo = accountInfo
+	g.mu.Unlock()
 	return nil
 }
 
-// Ask let you ask a new question with the given Version
-func (*gpt) Ask(question string, version Version) {
+// Ask let you ask a new question with the given Version in a new conversation. It returns the final answer of the
+// assistant and the id of the created conversation. It returns an error wrapping ErrPaidSubscriptionRequired if the
+// account plan does not allow using the given Version
+func (g *gpt) Ask(question string, version Version) (string, string, error) {
+	return g.AskContext(context.Background(), question, version)
+}
+
+// AskContext let you ask a new question with the given Version in a new conversation using the given context.Context.
+// It returns the final answer of the assistant and the id of the created conversation
+func (g *gpt) AskContext(ctx context.Context, question string, version Version) (string, string, error) {
+	model, err := g.modelForVersion(version)
+	if err != nil {
+		return "", "", err
+	}
+	var answer string
+	conversation, err := g.CreateConversationContext(ctx, question, model, func(response ConversationResponse) {
+		answer = response.Text
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return answer, conversation.ID, nil
+}
 
+// modelForVersion returns the first model slug available for the current user which corresponds to the given Version
+func (g *gpt) modelForVersion(version Version) (string, error) {
+	g.mu.RLock()
+	accountInfo := g.accountInfo
+	g.mu.RUnlock()
+	if accountInfo == nil {
+		return "", errors.New("account information is not available, user needs to be logged in")
+	}
+	if version.requiresPaidSubscription() && !accountInfo.AccountPlan.IsPaidSubscriptionActive {
+		return "", fmt.Errorf("can not use %s: %w", version, ErrPaidSubscriptionRequired)
+	}
+	for _, slug := range version.modelSlugs() {
+		if g.isModelExists(slug) {
+			return slug, nil
+		}
+	}
+	return "", fmt.Errorf("there's no available model for %s: %w", version, ErrModelNotFound)
 }
 
-// updateConversationHistory updates the conversationHistory attribute of the current gpt instance
-func (g *gpt) updateConversationHistory(maxRetry, limit uint) error {
-	logger.Debug("Make a first request to get the total number of conversations")
-	response, err := g.getConversationHistory(0, limit)
+// updateConversationHistory updates the conversationHistory attribute of the current gpt instance by loading the pages
+// of the given limit. As the total number of conversations does not always match the number of loaded conversations,
+// a page which does not bring any new conversation is retried with the backoff of the retry policy, up to
+// maxEmptyHistoryPages times
+func (g *gpt) updateConversationHistory(ctx context.Context, limit uint) error {
+	g.logger.Debug("Make a first request to get the total number of conversations")
+	response, err := g.getConversationHistory(ctx, 0, limit)
 	if err != nil {
-		logger.Error("Error while getting user's conversations")
+		g.logger.Error("Error while getting user's conversations", zap.Error(err))
 		return err
 	}
 	g.conversationHistory.addAll(response.Items)
-	logger.Debug("Items added ", zap.Int("number-of-items", g.conversationHistory.size()))
+	g.logger.Debug("Items added ", zap.Int("number-of-items", g.conversationHistory.size()))
 	var attempts uint = 0
-	for g.conversationHistory.size() < response.Total && attempts < maxRetry {
-		// Wait for a random timeout
-		randomTimeOut := randomTimeOut()
-		logger.Debug("Waiting for ", zap.Float64("timeout", randomTimeOut))
-		time.Sleep(time.Duration(randomTimeOut) * time.Millisecond)
-		response, err = g.getConversationHistory(uint(g.conversationHistory.size()), uint(math.Min(float64(limit), float64(response.Total-g.conversationHistory.size()))))
+	for g.conversationHistory.size() < response.Total && attempts < maxEmptyHistoryPages {
+		response, err = g.getConversationHistory(ctx, uint(g.conversationHistory.size()), uint(math.Min(float64(limit), float64(response.Total-g.conversationHistory.size()))))
 		before := g.conversationHistory.size()
 		if err != nil {
 			return err
 		}
 		g.conversationHistory.addAll(response.Items)
-		logger.Debug("Items added ", zap.Int("number-of-items", g.conversationHistory.size()))
+		g.logger.Debug("Items added ", zap.Int("number-of-items", g.conversationHistory.size()))
 		if before == g.conversationHistory.size() {
-			logger.Warn("The call was not bring any result", zap.Int("size", g.conversationHistory.size()), zap.Uint("attempts-count", attempts))
+			g.logger.Warn("The call was not bring any result", zap.Int("size", g.conversationHistory.size()), zap.Uint("attempts-count", attempts))
 			/* For some reason the total number does not always match with the reel number of conversations.
 			While this solution needs to be investigated more carefully, for now we are counting a number of unsuccessful
 			attempts and stop on maxAttempts number of attempts
 			*/
 			attempts++
+			if attempts < maxEmptyHistoryPages {
+				err = sleepContext(ctx, g.retryPolicy.backoff(attempts-1, nil))
+				if err != nil {
+					return err
+				}
+			}
 		}
 
 	}
@@ -222,20 +197,30 @@ func (g *gpt) updateConversationHistory(maxRetry, limit uint) error {
 
 // History returns the history of conversations as a slice of ConversationHistoryItem
 func (g *gpt) History() ([]ConversationHistoryItem, error) {
-	err := g.updateConversationHistory(5, 100)
+	return g.HistoryContext(context.Background())
+}
+
+// HistoryContext returns the history of conversations as a slice of ConversationHistoryItem using the given context.Context
+func (g *gpt) HistoryContext(ctx context.Context) ([]ConversationHistoryItem, error) {
+	err := g.updateConversationHistory(ctx, 100)
 	if err != nil {
 		return nil, err
 	}
 	// Return the created items
-	return g.conversationHistory.Content, nil
+	return g.conversationHistory.items(), nil
 }
 
 // LoadConversation loads a conversation from the chat history using the conversation uuid
 func (g *gpt) LoadConversation(uuid string) (*Conversation, error) {
+	return g.LoadConversationContext(context.Background(), uuid)
+}
+
+// LoadConversationContext loads a conversation from the chat history using the conversation uuid and the given context.Context
+func (g *gpt) LoadConversationContext(ctx context.Context, uuid string) (*Conversation, error) {
 	element := g.conversationHistory.find(uuid)
 	if element == nil {
-		logger.Warn("Can not find conversation, we'll try to reload the conversation history and re-try", zap.String("conversation-uuid", uuid))
-		err := g.updateConversationHistory(5, 100)
+		g.logger.Warn("Can not find conversation, we'll try to reload the conversation history and re-try", zap.String("conversation-id", uuid))
+		err := g.updateConversationHistory(ctx, 100)
 		if err != nil {
 			return nil, err
 		}
@@ -245,218 +230,328 @@ func (g *gpt) LoadConversation(uuid string) (*Conversation, error) {
 			return nil, fmt.Errorf("can not find conversation with uuid %s", uuid)
 		}
 	}
-	return g.getConversation(uuid)
+	return g.getConversation(ctx, uuid)
 
 }
 
+// Close stops the background session refresher and releases the resources used by the Authenticator, such as the open
+// page and the browser window
+func (g *gpt) Close() error {
+	g.stopSessionRefresher()
+	return g.authenticator.Close()
+}
+
+// Debug function is only used for debugging purposes, it disables the default behavior of playwright which is closing
+// browser and page once the execution is done. It does nothing if the browser is not used
+func (g *gpt) Debug() {
+	if b, ok := g.authenticator.(*browserAuthenticator); ok {
+		b.debug()
+	}
+}
+
 // NewChat creates a new chat
 func (*gpt) NewChat() {
 
 }
 
-// Debug function is only used for debugging purposes, it disables the default behavior of playwright which is closing
-// browser and page once the execution is done
-func (g *gpt) Debug() {
-	g.page.WaitForTimeout(100000000000)
+// Metrics returns the statistics of the requests sent by the current gpt instance
+func (g *gpt) Metrics() Metrics {
+	return g.limiter.metrics()
 }
 
-// saveBrowserContexts saves the browser contexts of the *gpt to the browserContextPath
-func (g *gpt) saveBrowserContexts() error {
-	contexts := g.browser.Contexts()
-	if len(contexts) > 1 {
-		logger.Fatal("Multiple contexts contexts detected", zap.Int("length", len(contexts)))
-	}
-	logger.Debug("Updating browser context", zap.String("path", g.browserContextPath))
-	_, err := contexts[0].StorageState(g.browserContextPath)
+// AccountInfo returns the UserAccountInfo instance related to the current user account
+func (g *gpt) AccountInfo() UserAccountInfo {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return *g.accountInfo
+}
+
+// Models returns the list of available models for the userr
+func (g *gpt) Models() ([]ModelInfo, error) {
+	return g.ModelsContext(context.Background())
+}
+
+// ModelsContext returns the list of available models for the user using the given context.Context
+func (g *gpt) ModelsContext(ctx context.Context) ([]ModelInfo, error) {
+	modelResponses, err := g.getModels(ctx)
 	if err != nil {
-		logger.Error("Something went wrong when saving the browser context", zap.String("path", g.browserContextPath))
-		return err
+		return nil, err
 	}
-	logger.Debug("Browser context updated", zap.String("path", g.browserContextPath))
-	return nil
+	return modelResponses.Models, err
 }
 
-// getPopupDialog returns the playwright.ElementHandle related to the popupDialog selected by popupDialogSelector
-// if there's no pop-up dialog it returns nil
-func (g *gpt) getPopupDialog() playwright.ElementHandle {
-	elementHandle, err := g.page.WaitForSelector(popupDialogSelector, playwright.PageWaitForSelectorOptions{Timeout: g.timeout})
-	if err != nil {
-		logger.Debug("Popup selector does not exists")
-		return nil
-	}
-	logger.Debug("Popup exists returning the element handle")
-	return elementHandle
-}
-
-// passPopupDialog closes the pop-up dialog if there's any. To avoid that it happens again and again it updates the
-// browserContext identified by browserContextPath. If something getc
-func (g *gpt) passPopupDialog() error {
-	if g.popupPassed {
-		logger.Debug("Pop-up already passed no need to repass")
-		return nil
-	}
-	popupDialogElementHandler := g.getPopupDialog()
-	if popupDialogElementHandler == nil {
-		logger.Debug("There's no popup to pass")
-		g.popupPassed = true
-		// If there's nothing to pass, just return
-		return nil
-	}
-	for popupDialogElementHandler != nil {
-		last := false
-		logger.Debug("Waiting for next button")
-		buttonHandle, err := popupDialogElementHandler.WaitForSelector(nextButtonSelector, playwright.ElementHandleWaitForSelectorOptions{Timeout: g.timeout})
-		if err != nil {
-			logger.Debug("Next button does not exists in popup. Waiting for done button")
-			buttonHandle, err = popupDialogElementHandler.WaitForSelector(doneButtonSelector, playwright.ElementHandleWaitForSelectorOptions{Timeout: g.timeout})
-			if err != nil {
-				logger.Error("Either next button or done button should appear. Something is probably wrong")
-				return err
-			}
-			last = true
-			logger.Debug("Done button appeared")
-		}
-		logger.Debug("Will click on button")
-		err = buttonHandle.Click()
-		if err != nil {
-			logger.Error("Something went wrong while clicking on button inside of the pop-up")
-			return err
-		}
-		if last {
-			logger.Debug("Dialog passed")
-			g.popupPassed = true
-			break
+func (g *gpt) isModelExists(model string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, availableModelSlug := range g.availableModels {
+		if model == availableModelSlug {
+			return true
 		}
-		logger.Debug("Updating popup element handler")
-		popupDialogElementHandler = g.getPopupDialog()
 	}
-	logger.Debug("Updating the browser context after popup")
-	// Update the browser context once the dialog is closed
-	return g.saveBrowserContexts()
+	return false
 }
 
-// getUserCookiesSupplier creates a httpCookieSupplier for the given url string passed in parameters
-func (g *gpt) getUserCookiesSupplier(u string) httpCookieSupplier {
-	return func() ([]*http.Cookie, error) {
-		loginNeeded, err := g.userNeedsToLogin()
-		if err != nil {
-			return nil, err
-		}
-		if loginNeeded {
-			// If user needs to log in
-			// Check if both username and password are provided
-			if g.username == nil || g.password == nil {
-				return nil, errors.New("can generate cookies as the username or password is not provided and user needs to be logged in")
-			}
-			err = g.internalLogin(*g.username, *g.password)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			// If user does not need to log in pass te pop-up dialog if applicable
-			err = g.passPopupDialog()
-			if err != nil {
-				return nil, err
-			}
-		}
-		// Get cookies for the given url string
-		cookies, err := g.page.Context().Cookies(u)
+// CreateConversation creates a new conversation by sending the given message and using the given model. For each response
+// received by the ChatGPT, it calls the onResponse callback with the received response as ConversationResponse. Once all
+// events of the response are received, the related Conversation is loaded and returned
+func (g *gpt) CreateConversation(message, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	return g.CreateConversationContext(context.Background(), message, model, onResponse)
+}
+
+// CreateConversationContext creates a new conversation by sending the given message and using the given model and
+// context.Context. Cancelling the context stops the generation of the response
+func (g *gpt) CreateConversationContext(ctx context.Context, message, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	if !g.isModelExists(model) {
+		return nil, fmt.Errorf("%s is not a valid model: %w", model, ErrModelNotFound)
+	}
+	conversationId, err := g.sendMessageToNewConversation(ctx, message, model, onResponse)
+	if err != nil {
+		return nil, err
+	}
+	return g.LoadConversationContext(ctx, string(conversationId))
+}
+
+// SendMessage sends the given message to the existing conversation identified by conversationID using the given model.
+// The message is sent as a reply to the message identified by parentMessageID. If parentMessageID is empty, the
+// conversation is loaded and its CurrentNode is used as the parent message. For each response received by the ChatGPT,
+// it calls the onResponse callback with the received response as ConversationResponse. Once all events of the response
+// are received, the updated Conversation is loaded and returned
+func (g *gpt) SendMessage(conversationID, parentMessageID, message, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	return g.SendMessageContext(context.Background(), conversationID, parentMessageID, message, model, onResponse)
+}
+
+// SendMessageContext sends the given message to the existing conversation identified by conversationID using the given
+// model and context.Context. Cancelling the context stops the generation of the response
+func (g *gpt) SendMessageContext(ctx context.Context, conversationID, parentMessageID, message, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	if !g.isModelExists(model) {
+		return nil, fmt.Errorf("%s is not a valid model: %w", model, ErrModelNotFound)
+	}
+	if isEmpty(parentMessageID) {
+		conversation, err := g.LoadConversationContext(ctx, conversationID)
 		if err != nil {
 			return nil, err
 		}
-		// Convert playwright.BrowserContextCookiesResult to http.Cookie
-		httpCookies := playwrightCookiesToHttpCookies(cookies)
-		// Return them
-		return httpCookies, nil
+		parentMessageID = conversation.CurrentNode
+	}
+	_, err := g.sendMessageToExistingConversation(ctx, conversationID, parentMessageID, message, model, onResponse)
+	if err != nil {
+		return nil, err
+	}
+	return g.LoadConversationContext(ctx, conversationID)
+}
+
+// Regenerate regenerates the last response of the assistant in the conversation identified by conversationID using the
+// given model. The new response is added as a sibling of the current response. For each response received by the
+// ChatGPT, it calls the onResponse callback with the received response as ConversationResponse. Once all events of the
+// response are received, the updated Conversation is loaded and returned with the new response as its CurrentNode
+func (g *gpt) Regenerate(conversationID, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	return g.RegenerateContext(context.Background(), conversationID, model, onResponse)
+}
+
+// RegenerateContext regenerates the last response of the assistant in the conversation identified by conversationID
+// using the given model and context.Context. Cancelling the context stops the generation of the response
+func (g *gpt) RegenerateContext(ctx context.Context, conversationID, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	if !g.isModelExists(model) {
+		return nil, fmt.Errorf("%s is not a valid model: %w", model, ErrModelNotFound)
+	}
+	conversation, err := g.LoadConversationContext(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	currentNode, ok := conversation.Node(conversation.CurrentNode)
+	if !ok || currentNode.Message == nil || currentNode.Message.Author.Role != "assistant" {
+		return nil, fmt.Errorf("the current node of the conversation %s is not a response of the assistant", conversationID)
+	}
+	userNode, ok := conversation.Node(currentNode.Parent)
+	if !ok || userNode.Message == nil || userNode.Message.Author.Role != "user" {
+		return nil, fmt.Errorf("can not find the user message to regenerate the response in conversation %s", conversationID)
+	}
+	messageRequest := createVariantMessageRequest(*userNode.Message, model, conversationID, userNode.Parent, g.timeZoneOffset)
+	return g.sendMessageRequestAndSelectResponse(ctx, messageRequest, onResponse)
+}
+
+// EditMessage replaces the user message identified by messageID in the conversation identified by conversationID with
+// the given newText and sends it using the given model. The new message is added as a sibling of the edited message,
+// which creates a new branch in the conversation. For each response received by the ChatGPT, it calls the onResponse
+// callback with the received response as ConversationResponse. Once all events of the response are received, the
+// updated Conversation is loaded and returned with the new response as its CurrentNode
+func (g *gpt) EditMessage(conversationID, messageID, newText, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	return g.EditMessageContext(context.Background(), conversationID, messageID, newText, model, onResponse)
+}
+
+// EditMessageContext replaces the user message identified by messageID in the conversation identified by
+// conversationID with the given newText and sends it using the given model and context.Context. Cancelling the context
+// stops the generation of the response
+func (g *gpt) EditMessageContext(ctx context.Context, conversationID, messageID, newText, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	if !g.isModelExists(model) {
+		return nil, fmt.Errorf("%s is not a valid model: %w", model, ErrModelNotFound)
+	}
+	conversation, err := g.LoadConversationContext(ctx, conversationID)
+	if err != nil {
+		return nil, err
 	}
+	editedNode, ok := conversation.Node(messageID)
+	if !ok {
+		return nil, fmt.Errorf("can not find message %s in conversation %s", messageID, conversationID)
+	}
+	if editedNode.Message == nil || editedNode.Message.Author.Role != "user" {
+		return nil, fmt.Errorf("message %s in conversation %s is not a user message", messageID, conversationID)
+	}
+	messageRequest, err := createMessageRequestInExistingConversation(newText, model, conversationID, editedNode.Parent, g.timeZoneOffset)
+	if err != nil {
+		return nil, err
+	}
+	return g.sendMessageRequestAndSelectResponse(ctx, messageRequest, onResponse)
+}
+
+// ContinueGeneration continues the generation of the last response of the assistant in the conversation identified by
+// conversationID using the given model. It is used when the response is truncated, see ConversationResponse.IsTruncated.
+// The responses passed to the onResponse callback contain the text of the whole response, including the text generated
+// before the continuation. Once all events of the response are received, the updated Conversation is loaded and returned
+func (g *gpt) ContinueGeneration(conversationID, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	return g.ContinueGenerationContext(context.Background(), conversationID, model, onResponse)
+}
+
+// ContinueGenerationContext continues the generation of the last response of the assistant in the conversation
+// identified by conversationID using the given model and context.Context. Cancelling the context stops the generation
+// of the response
+func (g *gpt) ContinueGenerationContext(ctx context.Context, conversationID, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
+	if !g.isModelExists(model) {
+		return nil, fmt.Errorf("%s is not a valid model: %w", model, ErrModelNotFound)
+	}
+	conversation, err := g.LoadConversationContext(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	currentNode, ok := conversation.Node(conversation.CurrentNode)
+	if !ok || currentNode.Message == nil || currentNode.Message.Author.Role != "assistant" {
+		return nil, fmt.Errorf("the current node of the conversation %s is not a response of the assistant", conversationID)
+	}
+	messageRequest := createContinueMessageRequest(model, conversationID, currentNode.ID, g.timeZoneOffset)
+	_, err = g.sendMessageRequest(ctx, messageRequest, joinParts(currentNode.Message.Content.Parts), onResponse.handler())
+	if err != nil {
+		return nil, err
+	}
+	return g.LoadConversationContext(ctx, conversationID)
+}
+
+// sendMessageRequestAndSelectResponse sends the given message request to an existing conversation, then loads the
+// conversation and selects the received response as its CurrentNode
+func (g *gpt) sendMessageRequestAndSelectResponse(ctx context.Context, messageRequest *internal.NewMessageRequest, onResponse conversationResponseConsumer) (*Conversation, error) {
+	var responseMessageID string
+	_, err := g.sendMessageRequest(ctx, messageRequest, "", func(response ConversationResponse) error {
+		responseMessageID = response.Message.ID
+		return onResponse.handler()(response)
+	})
+	if err != nil {
+		return nil, err
+	}
+	conversation, err := g.LoadConversationContext(ctx, messageRequest.ConversationId)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := conversation.Mapping[responseMessageID]; ok {
+		conversation.CurrentNode = responseMessageID
+	}
+	return conversation, nil
+}
+
+// RenameConversation renames the conversation identified by conversationID with the given title
+func (g *gpt) RenameConversation(conversationID, title string) error {
+	return g.RenameConversationContext(context.Background(), conversationID, title)
 }
 
-// internalLogin just handles the login with the given username and password without any side effects
-func (g *gpt) internalLogin(username, password string) error {
-	needLogin, err := g.userNeedsToLogin()
+// RenameConversationContext renames the conversation identified by conversationID with the given title using the
+// given context.Context
+func (g *gpt) RenameConversationContext(ctx context.Context, conversationID, title string) error {
+	err := g.updateConversation(ctx, conversationID, internal.UpdateConversationRequestBody{Title: &title})
 	if err != nil {
 		return err
 	}
-	if needLogin {
-		logger.Debug("User needs to login")
-		err := g.page.Click(loginButtonSelector)
-		if err != nil {
-			logger.Error("Error while clicking on login button selector")
-			return err
-		}
-		err = g.page.Fill(usernameInputSelector, username)
-		if err != nil {
-			logger.Error("Error while filling username input")
-			return err
-		}
-		err = g.page.Click(continueButtonSelector)
-		if err != nil {
-			logger.Error("Error while clicking on continue button")
-			return err
-		}
-		err = g.page.Fill(passwordInputSelector, password)
-		if err != nil {
-			logger.Error("Error while filling the password input")
-			return err
-		}
-		err = g.page.Click(continueButtonSelector)
-		if err != nil {
-			logger.Error("Error while clicking on continue button")
-			return err
-		}
-		err = g.page.WaitForURL(fmt.Sprintf("%s/chat", baseURL))
-		if err != nil {
-			logger.Error("Error while waiting the u changes to logged in URL")
-			return err
-		}
-		err = g.saveBrowserContexts()
-		if err != nil {
-			return err
-		}
-		// Login successful save login information
-		g.username = &username
-		g.password = &password
+	item := g.conversationHistory.find(conversationID)
+	if item != nil {
+		item.Title = title
+		g.conversationHistory.update(*item)
 	}
-	err = g.passPopupDialog()
+	return nil
+}
+
+// ArchiveConversation archives the conversation identified by conversationID. Archived conversations are removed from
+// the conversation history
+func (g *gpt) ArchiveConversation(conversationID string) error {
+	return g.ArchiveConversationContext(context.Background(), conversationID)
+}
+
+// ArchiveConversationContext archives the conversation identified by conversationID using the given context.Context
+func (g *gpt) ArchiveConversationContext(ctx context.Context, conversationID string) error {
+	isArchived := true
+	err := g.updateConversation(ctx, conversationID, internal.UpdateConversationRequestBody{IsArchived: &isArchived})
 	if err != nil {
 		return err
 	}
+	g.conversationHistory.remove(conversationID)
 	return nil
 }
 
-// AccountInfo returns the UserAccountInfo instance related to the current user account
-func (g *gpt) AccountInfo() UserAccountInfo {
-	return *g.accountInfo
+// DeleteConversation deletes the conversation identified by conversationID by hiding it
+func (g *gpt) DeleteConversation(conversationID string) error {
+	return g.DeleteConversationContext(context.Background(), conversationID)
 }
 
-// Models returns the list of available models for the userr
-func (g *gpt) Models() ([]ModelInfo, error) {
-	modelResponses, err := g.getModels()
+// DeleteConversationContext deletes the conversation identified by conversationID using the given context.Context
+func (g *gpt) DeleteConversationContext(ctx context.Context, conversationID string) error {
+	isVisible := false
+	err := g.updateConversation(ctx, conversationID, internal.UpdateConversationRequestBody{IsVisible: &isVisible})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return modelResponses.Models, err
+	g.conversationHistory.remove(conversationID)
+	return nil
 }
 
-func (g *gpt) isModelExists(model string) bool {
-	for _, availableModelSlug := range g.availableModels {
-		if model == availableModelSlug {
-			return true
-		}
+// DeleteAllConversations deletes all conversations of the user
+func (g *gpt) DeleteAllConversations() error {
+	return g.DeleteAllConversationsContext(context.Background())
+}
+
+// DeleteAllConversationsContext deletes all conversations of the user using the given context.Context
+func (g *gpt) DeleteAllConversationsContext(ctx context.Context) error {
+	isVisible := false
+	err := g.updateConversations(ctx, internal.UpdateConversationRequestBody{IsVisible: &isVisible})
+	if err != nil {
+		return err
 	}
-	return false
+	g.conversationHistory.clear()
+	return nil
 }
 
-// CreateConversation creates a new conversation by sending the given message and using the given model. For each response
-// received by the ChatGPT, it calls the onResponse callback with the received response as ConversationResponse. Once all
-// events of the response are received, the related Conversation is loaded and returned
-func (g *gpt) CreateConversation(message, model string, onResponse conversationResponseConsumer) (*Conversation, error) {
-	if !g.isModelExists(model) {
-		return nil, fmt.Errorf("%s is not a valid model", model)
+// ShareConversation creates a public link to the conversation identified by conversationID, up to its current node.
+// If anonymous is true, the name of the user is not displayed on the shared conversation
+func (g *gpt) ShareConversation(conversationID string, anonymous bool) (*SharedConversation, error) {
+	return g.ShareConversationContext(context.Background(), conversationID, anonymous)
+}
+
+// ShareConversationContext creates a public link to the conversation identified by conversationID using the given
+// context.Context
+func (g *gpt) ShareConversationContext(ctx context.Context, conversationID string, anonymous bool) (*SharedConversation, error) {
+	conversation, err := g.LoadConversationContext(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	share, err := g.createShare(ctx, conversationID, conversation.CurrentNode, anonymous)
+	if err != nil {
+		return nil, err
+	}
+	// The created link is only visible by the user until it is made public
+	share.IsPublic = true
+	share.IsVisible = true
+	share.IsAnonymous = anonymous
+	if isEmpty(share.HighlightedMessageID) {
+		share.HighlightedMessageID = conversation.CurrentNode
 	}
-	conversationId, err := g.sendMessageToNewConversation(message, model, onResponse)
+	err = g.updateShare(ctx, *share)
 	if err != nil {
 		return nil, err
 	}
-	return g.LoadConversation(string(conversationId))
+	return share, nil
 }
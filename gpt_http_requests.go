@@ -3,6 +3,7 @@ package gogpt
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,88 +12,151 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // initCookieJarAndHttpClient initialises the autoFillingCookieJar and http.Client instances inside the current *gpt instance
-func (g *gpt) initCookieJarAndHttpClient() error {
+func (g *gpt) initCookieJarAndHttpClient(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	if g.cookieJar == nil {
-		cookieJar, err := createNewAutoFillingCookieJar(baseURL, g.getUserCookiesSupplier(baseURL))
+		cookieJar, err := createNewAutoFillingCookieJar(ctx, g.baseURL, g.getUserCookiesSupplier(g.baseURL))
 		if err != nil {
 			return err
 		}
 		g.cookieJar = cookieJar
 		g.httpClient = &http.Client{
-			Jar: g.cookieJar,
+			Jar:       g.cookieJar,
+			Transport: g.transport,
 		}
 		return nil
 	}
 	if g.httpClient == nil {
 		g.httpClient = &http.Client{
-			Jar: g.cookieJar,
+			Jar:       g.cookieJar,
+			Transport: g.transport,
 		}
 	}
 	return nil
 }
 
-// initSession initializes the session of the current gpt instance.
-// It returns an error if something goes wrong while unmarshalling the api response
-func (g *gpt) initSession() error {
-	err := g.cookieJar.setExpiredCookies()
-	if err != nil {
+// client returns the http.Client and the autoFillingCookieJar of the current gpt instance
+func (g *gpt) client() (*http.Client, *autoFillingCookieJar) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.httpClient, g.cookieJar
+}
+
+// currentSession returns the current Session of the gpt instance, or nil if it is not initialised
+func (g *gpt) currentSession() *Session {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.session
+}
+
+// sessionAge returns the duration since the current session of the gpt instance was fetched
+func (g *gpt) sessionAge() time.Duration {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return time.Since(g.sessionFetchedAt)
+}
+
+// getUserCookiesSupplier creates a httpCookieSupplier for the given url string passed in parameters, which gets the
+// cookies from the Authenticator of the current gpt instance
+func (g *gpt) getUserCookiesSupplier(u string) httpCookieSupplier {
+	return func(ctx context.Context) ([]*http.Cookie, error) {
+		return g.authenticator.Cookies(ctx, u)
+	}
+}
+
+// initSession initializes the session of the current gpt instance using its Authenticator. The concurrent calls
+// share the same request to the session endpoint.
+// It returns an error if something goes wrong while getting the session
+func (g *gpt) initSession(ctx context.Context) error {
+	return g.loadSession(ctx, false)
+}
+
+// loadSession gets a new session using the Authenticator of the current gpt instance. The cookies are renewed before
+// getting the session if renewCookies is true, otherwise only the expired cookies are renewed. The concurrent calls
+// share the same request to the session endpoint, and the session hooks are called once the request is done
+func (g *gpt) loadSession(ctx context.Context, renewCookies bool) error {
+	var notify func()
+	err := g.sessionRefresh.do(ctx, func() error {
+		s, err := g.fetchSession(ctx, renewCookies)
+		notify = g.setSession(ctx, s, err)
 		return err
+	})
+	// The hooks are called outside the refresh, so they can use the current gpt instance
+	if notify != nil {
+		notify()
 	}
-	resp, err := g.httpClient.Get("https://chat.openai.com/api/auth/session")
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	g.startSessionRefresher()
+	return nil
+}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+// fetchSession renews the cookies and returns the session from the Authenticator of the current gpt instance. A
+// session without access token, returned by the session endpoint when the user is logged out, is an error wrapping
+// ErrNotLoggedIn
+func (g *gpt) fetchSession(ctx context.Context, renewCookies bool) (*Session, error) {
+	client, cookieJar := g.client()
+	var err error
+	if renewCookies {
+		err = cookieJar.renewCookies(ctx)
+	} else {
+		err = cookieJar.setExpiredCookies(ctx, g.sessionRefreshPolicy.Margin)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	logger.Debug("session token response", zap.String("session-request-response", string(body)))
-	s, err := unmarshalGPTSessionResponseJSON(body)
+	s, err := g.authenticator.Session(ctx, client, g.endpoints.Session)
 	if err != nil {
-		logger.Error("Error while unmarshalling session response")
-		return err
+		return nil, err
 	}
-	g.session = s
-
-	return nil
+	if s == nil || isEmpty(s.AccessToken) {
+		return nil, fmt.Errorf("the session has no access token: %w", ErrNotLoggedIn)
+	}
+	return s, nil
 }
 
 // refreshSession verifies if there's a session exists. If there's no session exists, creates one using initSession
-// if there's an existing session verifies if the session is expired using isExpired function. If the session is expired
-// recreates the session using initSession
-func (g *gpt) refreshSession() error {
-	if g.session == nil {
-		return g.initSession()
+// if there's an existing session verifies if the session is expired, or expires in less than the margin of the
+// SessionRefreshPolicy, using isExpired function. If the session is expired recreates the session using initSession
+func (g *gpt) refreshSession(ctx context.Context) error {
+	session := g.currentSession()
+	if session == nil {
+		return g.initSession(ctx)
 	}
-	isExpired, err := g.session.isExpired()
+	isExpired, err := session.isExpired(g.sessionRefreshPolicy.Margin)
 	if err != nil {
-		logger.Error("Error while checking if the existing session is expired", zap.String("expiration-date-string", g.session.Expires))
-		return g.initSession()
+		g.logger.Error("Error while checking if the existing session is expired", zap.String("expiration-date-string", session.Expires), zap.Error(err))
+		return g.initSession(ctx)
 	}
 	if isExpired {
-		return g.initSession()
+		return g.initSession(ctx)
+	}
+	// A session without expiration time is refreshed periodically, and when a request is rejected
+	if !session.hasExpirationTime() && g.sessionAge() >= g.sessionRefreshPolicy.Interval {
+		return g.initSession(ctx)
 	}
 	return nil
 }
 
 // prepareRequest prepares the cookies and the user session to use in each http request. This function should be called
 // before each http request to ensure that the request will not be blocked
-func (g *gpt) prepareRequest() error {
-	err := g.initCookieJarAndHttpClient()
+func (g *gpt) prepareRequest(ctx context.Context) error {
+	err := g.initCookieJarAndHttpClient(ctx)
 	if err != nil {
 		return err
 	}
-	err = g.cookieJar.setExpiredCookies()
+	_, cookieJar := g.client()
+	err = cookieJar.setExpiredCookies(ctx, g.sessionRefreshPolicy.Margin)
 	if err != nil {
 		return err
 	}
-	err = g.refreshSession()
+	err = g.refreshSession(ctx)
 	if err != nil {
 		return err
 	}
@@ -100,48 +164,93 @@ func (g *gpt) prepareRequest() error {
 }
 
 // createAPIURL creates the API url for the given endpoint
-func createAPIURL(endpoint string) string {
-	return fmt.Sprintf("%s/backend-api/%s", baseURL, endpoint)
+func (g *gpt) createAPIURL(endpoint string) string {
+	return g.endpoints.apiURL(endpoint)
 }
 
-// createRequest creates a new http.Request using given method, endpoint and body.
-func (g *gpt) createRequest(method string, endpoint string, body io.Reader) (*http.Request, error) {
-	err := g.prepareRequest()
+// createRequest creates a new http.Request using given context.Context, method, endpoint and body.
+func (g *gpt) createRequest(ctx context.Context, method string, endpoint string, body io.Reader) (*http.Request, error) {
+	err := g.prepareRequest(ctx)
 	if err != nil {
 		return nil, err
 	}
-	request, err := http.NewRequest(method, createAPIURL(endpoint), body)
+	request, err := http.NewRequestWithContext(ctx, method, g.createAPIURL(endpoint), body)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("authorization", fmt.Sprintf("Bearer %s", g.session.AccessToken))
+	request.Header.Set("authorization", fmt.Sprintf("Bearer %s", g.currentSession().AccessToken))
 	request.Header.Set("content-type", "application/json")
 	return request, nil
 }
 
-// runAPIRequest makes an HTTP request with given method on the given endpoint with the given requestBody as io.Reader.
-// It handles the response as JSON and unmarshal it to the parameterized type
-func runAPIRequest[T any](g *gpt, method, endpoint string, requestBody io.Reader) (*T, error) {
-	request, err := g.createRequest(method, endpoint, requestBody)
+// runAPIRequest makes an HTTP request with given context.Context and method on the given endpoint with the given
+// requestBody. It handles the response as JSON and unmarshal it to the parameterized type. The idempotent requests are
+// retried following the retry policy of the given gpt instance. A request rejected with the 401 status code is sent
+// again once after the renewal of the session
+func runAPIRequest[T any](ctx context.Context, g *gpt, method, endpoint string, requestBody []byte) (*T, error) {
+	var response *T
+	renewed := false
+	err := g.retry(ctx, method, endpoint, func() error {
+		var err error
+		response, err = runSingleAPIRequest[T](ctx, g, method, endpoint, requestBody)
+		if renewed || !isUnauthorizedResponse(err) {
+			return err
+		}
+		renewed = true
+		g.logger.Debug("Renewing the session after a rejected request", zap.String("endpoint", endpoint), zap.String("method", method))
+		if renewErr := g.renewSession(ctx); renewErr != nil {
+			return err
+		}
+		response, err = runSingleAPIRequest[T](ctx, g, method, endpoint, requestBody)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	resp, err := g.httpClient.Do(request)
+	return response, nil
+}
+
+// isUnauthorizedResponse returns true if the given error is an APIError with the 401 status code
+func isUnauthorizedResponse(err error) bool {
+	var apiError *APIError
+	return errors.As(err, &apiError) && apiError.StatusCode == http.StatusUnauthorized
+}
+
+// runSingleAPIRequest makes a single HTTP request with given context.Context and method on the given endpoint with the
+// given requestBody. It handles the response as JSON and unmarshal it to the parameterized type
+func runSingleAPIRequest[T any](ctx context.Context, g *gpt, method, endpoint string, requestBody []byte) (*T, error) {
+	var body io.Reader
+	if requestBody != nil {
+		body = bytes.NewReader(requestBody)
+	}
+	request, err := g.createRequest(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	release, err := g.limiter.acquire(ctx, requestClassOf(method, endpoint))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	client, _ := g.client()
+	resp, err := client.Do(request)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	responseBody, err := io.ReadAll(resp.Body)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("run http %s request on  %s with %+v failed with status code %d", method, endpoint, body, resp.StatusCode)
+		g.logger.Debug("API request failed", zap.String("endpoint", endpoint), zap.String("method", method),
+			zap.Int("status-code", resp.StatusCode))
+		return nil, newAPIError(resp, method, endpoint, responseBody)
 	}
 	var response T
-	if err := json.Unmarshal(body, &response); err != nil {
+	if err := json.Unmarshal(responseBody, &response); err != nil {
 		return nil, err
 	}
 
@@ -149,76 +258,216 @@ func runAPIRequest[T any](g *gpt, method, endpoint string, requestBody io.Reader
 }
 
 // getConversationHistory returns the history of conversation using given offset and limit as ConversationHistoryResponse
-func (g *gpt) getConversationHistory(offset, limit uint) (*ConversationHistoryResponse, error) {
-	return runAPIRequest[ConversationHistoryResponse](g, "GET", fmt.Sprintf("conversations?offset=%d&limit=%d", offset, limit), nil)
+func (g *gpt) getConversationHistory(ctx context.Context, offset, limit uint) (*ConversationHistoryResponse, error) {
+	return runAPIRequest[ConversationHistoryResponse](ctx, g, "GET", fmt.Sprintf("conversations?offset=%d&limit=%d", offset, limit), nil)
 }
 
 // getAccountInfo returns the additional information about the user's account as UserAccountInfo pointer
-func (g *gpt) getAccountInfo() (*UserAccountInfo, error) {
-	return runAPIRequest[UserAccountInfo](g, "GET", "accounts/check", nil)
+func (g *gpt) getAccountInfo(ctx context.Context) (*UserAccountInfo, error) {
+	return runAPIRequest[UserAccountInfo](ctx, g, "GET", "accounts/check", nil)
 }
 
 // getConversation get the details of a conversation by its uuid as Conversation pointer
-func (g *gpt) getConversation(uuid string) (*Conversation, error) {
-	return runAPIRequest[Conversation](g, "GET", fmt.Sprintf("conversation/%s", uuid), nil)
+func (g *gpt) getConversation(ctx context.Context, uuid string) (*Conversation, error) {
+	conversation, err := runAPIRequest[Conversation](ctx, g, "GET", fmt.Sprintf("conversation/%s", uuid), nil)
+	if err != nil {
+		return nil, err
+	}
+	if isEmpty(conversation.ID) {
+		conversation.ID = uuid
+	}
+	return conversation, nil
 }
 
 // getModels returns the available models as ModelsResponse
-func (g *gpt) getModels() (*ModelsResponse, error) {
-	return runAPIRequest[ModelsResponse](g, "GET", "models", nil)
+func (g *gpt) getModels(ctx context.Context) (*ModelsResponse, error) {
+	return runAPIRequest[ModelsResponse](ctx, g, "GET", "models", nil)
+}
+
+// updateConversation patches the conversation identified by the given uuid with the given
+// internal.UpdateConversationRequestBody
+func (g *gpt) updateConversation(ctx context.Context, uuid string, body internal.UpdateConversationRequestBody) error {
+	return g.runUpdateRequest(ctx, fmt.Sprintf("conversation/%s", uuid), body)
+}
+
+// updateConversations patches all conversations of the user with the given internal.UpdateConversationRequestBody
+func (g *gpt) updateConversations(ctx context.Context, body internal.UpdateConversationRequestBody) error {
+	return g.runUpdateRequest(ctx, "conversations", body)
+}
+
+// runUpdateRequest runs a PATCH request on the given endpoint with the given body. It returns an error if the
+// response does not indicate a success
+func (g *gpt) runUpdateRequest(ctx context.Context, endpoint string, body interface{}) error {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	response, err := runAPIRequest[successResponse](ctx, g, http.MethodPatch, endpoint, requestBody)
+	if err != nil {
+		return err
+	}
+	if !response.Success {
+		return fmt.Errorf("run http %s request on %s is not successful", http.MethodPatch, endpoint)
+	}
+	return nil
+}
+
+// createShare creates a shared link for the given node of the conversation identified by conversationId
+func (g *gpt) createShare(ctx context.Context, conversationId, currentNodeId string, anonymous bool) (*SharedConversation, error) {
+	requestBody, err := json.Marshal(internal.CreateShareRequestBody{
+		ConversationId: conversationId,
+		CurrentNodeId:  currentNodeId,
+		IsAnonymous:    anonymous,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return runAPIRequest[SharedConversation](ctx, g, http.MethodPost, "share/create", requestBody)
+}
+
+// updateShare updates the shared link identified by the ShareID of the given SharedConversation
+func (g *gpt) updateShare(ctx context.Context, share SharedConversation) error {
+	requestBody, err := json.Marshal(internal.UpdateShareRequestBody{
+		ShareId:              share.ShareID,
+		HighlightedMessageId: share.HighlightedMessageID,
+		Title:                share.Title,
+		IsPublic:             share.IsPublic,
+		IsVisible:            share.IsVisible,
+		IsAnonymous:          share.IsAnonymous,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = runAPIRequest[successResponse](ctx, g, http.MethodPatch, fmt.Sprintf("share/%s", share.ShareID), requestBody)
+	return err
 }
 
 // sendMessageToNewConversation creates a new conversation by sending the given message and using the given model.
 // for each response event it calls onResponse function to handle the response as ConversationResponse
-func (g *gpt) sendMessageToNewConversation(message, model string, onResponse conversationResponseConsumer) ([]byte, error) {
+func (g *gpt) sendMessageToNewConversation(ctx context.Context, message, model string, onResponse conversationResponseConsumer) ([]byte, error) {
 	messageRequest, err := createMessageRequestForNewConversation(message, model, g.timeZoneOffset)
 	if err != nil {
 		return nil, err
 	}
+	return g.sendMessageRequest(ctx, messageRequest, "", onResponse.handler())
+}
+
+// sendMessageToExistingConversation sends the given message to the conversation identified by conversationId as a child
+// of the message identified by parentMessageId, using the given model. For each response event it calls onResponse
+// function to handle the response as ConversationResponse
+func (g *gpt) sendMessageToExistingConversation(ctx context.Context, conversationId, parentMessageId, message, model string, onResponse conversationResponseConsumer) ([]byte, error) {
+	messageRequest, err := createMessageRequestInExistingConversation(message, model, conversationId, parentMessageId, g.timeZoneOffset)
+	if err != nil {
+		return nil, err
+	}
+	return g.sendMessageRequest(ctx, messageRequest, "", onResponse.handler())
+}
+
+// sendMessageRequest sends the given internal.NewMessageRequest using sendSingleMessageRequest. While the received
+// response is truncated, it continues its generation up to autoContinue times. The responses of the continuations are
+// passed to onResponse as the continuation of the truncated response. If previousText is not empty, the responses of
+// the given request are also passed as the continuation of previousText. It returns the id of the related conversation
+func (g *gpt) sendMessageRequest(ctx context.Context, messageRequest *internal.NewMessageRequest, previousText string, onResponse conversationResponseHandler) ([]byte, error) {
+	var last ConversationResponse
+	var handler conversationResponseHandler = func(response ConversationResponse) error {
+		last = response
+		return onResponse(response)
+	}
+	firstHandler := handler
+	if len(previousText) > 0 {
+		firstHandler = stitchContinuation(previousText, handler)
+	}
+	conversationId, err := g.sendSingleMessageRequest(ctx, messageRequest, firstHandler)
+	if err != nil {
+		return nil, err
+	}
+	for attempts := uint(0); attempts < g.autoContinue && last.IsTruncated(); attempts++ {
+		g.logger.Debug("Response is truncated, continuing the generation", zap.ByteString("conversation-id", conversationId), zap.String("message-id", last.Message.ID), zap.Uint("attempts-count", attempts))
+		continueRequest := createContinueMessageRequest(messageRequest.Model, string(conversationId), last.Message.ID, g.timeZoneOffset)
+		_, err = g.sendSingleMessageRequest(ctx, continueRequest, stitchContinuation(last.Text, handler))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if last.IsTruncated() {
+		g.logger.Warn("The response is truncated, use ContinueGeneration to continue its generation", zap.ByteString("conversation-id", conversationId), zap.String("message-id", last.Message.ID))
+	}
+	return conversationId, nil
+}
+
+// sendSingleMessageRequest posts the given internal.NewMessageRequest to the conversation endpoint and handles the returned
+// event stream using handleConversationResponseEvent. It returns the id of the related conversation
+func (g *gpt) sendSingleMessageRequest(ctx context.Context, messageRequest *internal.NewMessageRequest, onResponse conversationResponseHandler) ([]byte, error) {
+	resp, err := g.openConversationEventStream(ctx, messageRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// Read and process the events
+	reader := bufio.NewReader(resp.Body)
+	conversationId, err := g.handleConversationResponseEvent(ctx, reader, isEmpty(messageRequest.ConversationId), onResponse)
+	if err != nil {
+		return nil, err
+	}
+	return conversationId, nil
+}
+
+// openConversationEventStream posts the given internal.NewMessageRequest to the conversation endpoint using the given
+// context.Context and returns the *http.Response containing the event stream. The caller is responsible for closing
+// the body of the returned response
+func (g *gpt) openConversationEventStream(ctx context.Context, messageRequest *internal.NewMessageRequest) (*http.Response, error) {
 	requestBody, err := json.Marshal(*messageRequest)
 	if err != nil {
 		return nil, err
 	}
-	request, err := g.createRequest("POST", "conversation", bytes.NewBuffer(requestBody))
+	request, err := g.createRequest(ctx, "POST", "conversation", bytes.NewReader(requestBody))
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Accept", "text/event-stream")
 	request.Header.Set("DNT", "1")
-	request.Header.Set("Origin", "https://chat.openai.com")
-	request.Header.Set("Referer", "https://chat.openai.com/")
+	request.Header.Set("Origin", g.baseURL)
+	request.Header.Set("Referer", fmt.Sprintf("%s/", g.baseURL))
 	request.Header.Set("Sec-Fetch-Dest", "empty")
 	request.Header.Set("Sec-Fetch-Mode", "cors")
 	request.Header.Set("Sec-Fetch-Site", "same-site")
 	request.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/88.0.4324.146 Safari/537.36")
 
-	resp, err := g.httpClient.Do(request)
+	release, err := g.limiter.acquire(ctx, requestClassOf(http.MethodPost, "conversation"))
+	if err != nil {
+		return nil, err
+	}
+	// The slot is released once the response is received as the title and the moderation requests are sent while the
+	// event stream is being read
+	client, _ := g.client()
+	resp, err := client.Do(request)
+	release()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		reader, err := io.ReadAll(resp.Body)
 		if err != nil {
 			return nil, err
 		}
-		logger.Error("Send message to new conversation is failed", zap.Int("status-code", resp.StatusCode),
-			zap.String("body", string(reader)), zap.String("url", request.URL.String()),
-			zap.ByteString("request-body", requestBody))
-		return nil, fmt.Errorf("send message to new conversation is failed. Status code %d", resp.StatusCode)
+		g.logger.Error("Send message to conversation is failed", zap.Int("status-code", resp.StatusCode),
+			zap.String("body", string(reader)), zap.String("endpoint", "conversation"), zap.String("url", request.URL.String()),
+			zap.String("conversation-id", messageRequest.ConversationId))
+		// The request body contains the prompt, so it is only logged at debug level
+		g.logger.Debug("Request body of the failed message", zap.ByteString("request-body", requestBody))
+		return nil, newAPIError(resp, http.MethodPost, "conversation", reader)
 	}
-	// Read and process the events
-	reader := bufio.NewReader(resp.Body)
-	conversationId, err := g.handleConversationResponseEvent(reader, onResponse)
-	if err != nil {
-		return nil, err
-	}
-	return conversationId, nil
+	return resp, nil
 }
 
-// handleConversationResponseEvent handles the conversation response events as *bufio.Reader using the given conversationResponseConsumer function
-func (g *gpt) handleConversationResponseEvent(reader *bufio.Reader, onResponse conversationResponseConsumer) ([]byte, error) {
+// handleConversationResponseEvent handles the conversation response events as *bufio.Reader using the given conversationResponseHandler function.
+// The title of the conversation is only generated if isNewConversation is true. If onResponse returns an error, the
+// handling stops and the error is returned
+func (g *gpt) handleConversationResponseEvent(ctx context.Context, reader *bufio.Reader, isNewConversation bool, onResponse conversationResponseHandler) ([]byte, error) {
 	var conversationId = ""
+	var previousMessageId, previousText string
+	logger := g.logger
 	for {
 		line, err := reader.ReadString('\n')
 		if err != nil {
@@ -227,7 +476,7 @@ func (g *gpt) handleConversationResponseEvent(reader *bufio.Reader, onResponse c
 				logger.Debug("EOF detected", zap.String("current-line", line))
 				break
 			}
-			logger.Error("Error while handling event", zap.Any("error", err))
+			logger.Error("Error while handling event", zap.Error(err))
 			return nil, err
 		}
 		if isEmpty(line) {
@@ -252,31 +501,44 @@ func (g *gpt) handleConversationResponseEvent(reader *bufio.Reader, onResponse c
 			}
 			if isEmpty(conversationId) {
 				conversationId = response.ConversationID
+				logger = logger.With(zap.String("conversation-id", conversationId))
 			} else {
 				if conversationId != response.ConversationID {
-					logger.Warn("THe conversation id is different then the current one", zap.String("current-conversation-id", response.ConversationID), zap.String("existing-conversation-id", conversationId))
+					logger.Warn("THe conversation id is different then the current one", zap.String("received-conversation-id", response.ConversationID))
 				}
 			}
 			if response.Message.Author.Role == "user" {
-				title, err := g.GenerateTitle(response.ConversationID, response.Message.ID)
-				if err != nil {
-					logger.Error("Error while generating title")
-					return nil, err
+				if isNewConversation {
+					title, err := g.GenerateTitleContext(ctx, response.ConversationID, response.Message.ID)
+					if err != nil {
+						logger.Error("Error while generating title")
+						return nil, err
+					}
+					logger.Info("Title generated for the new conversation", zap.ByteString("title", title))
 				}
-				logger.Info("Title generated for the new conversation", zap.ByteString("title", title))
-				moderationResponse, err := g.Moderation(response.ConversationID, response.Message.ID, response.Message.Content.Parts[0])
+				moderationResponse, err := g.ModerationContext(ctx, response.ConversationID, response.Message.ID, response.Message.Content.Parts[0])
 				if err != nil {
 					logger.Error("Error while getting moderation",
-						zap.String("conversationId", response.ConversationID),
-						zap.String("messageId", response.Message.ID),
-						zap.String("messageText", response.Message.Content.Parts[0]))
+						zap.String("message-id", response.Message.ID),
+						zap.String("message-text", response.Message.Content.Parts[0]))
 					return nil, err
 				}
 				logger.Info("Moderation response for message", zap.Any("response", moderationResponse))
 				continue
 			}
 			if response.Message.Author.Role == "assistant" {
-				onResponse(response)
+				if response.Message.ID != previousMessageId {
+					// A new message starts, the text is not related to the previous one
+					previousMessageId = response.Message.ID
+					previousText = ""
+				}
+				response.Text = joinParts(response.Message.Content.Parts)
+				response.Delta, response.ReplacedRunes = textDelta(previousText, response.Text)
+				previousText = response.Text
+				err = onResponse(response)
+				if err != nil {
+					return nil, err
+				}
 				if response.Message.EndTurn != nil && *response.Message.EndTurn {
 					logger.Debug("Received the last message", zap.Any("response", response))
 					// If the response indicates the end, quit the loop
@@ -294,12 +556,18 @@ func (g *gpt) handleConversationResponseEvent(reader *bufio.Reader, onResponse c
 // GenerateTitle generates the title for the given conversation and given message. It returns the generated title as
 // []byte
 func (g *gpt) GenerateTitle(conversationId, messageId string) ([]byte, error) {
+	return g.GenerateTitleContext(context.Background(), conversationId, messageId)
+}
+
+// GenerateTitleContext generates the title for the given conversation and given message using the given context.Context.
+// It returns the generated title as []byte
+func (g *gpt) GenerateTitleContext(ctx context.Context, conversationId, messageId string) ([]byte, error) {
 	requestBody, err := json.Marshal(internal.GenerateConversationTitleRequestBody{MessageId: messageId})
 	if err != nil {
 		return nil, err
 	}
 	endPoint := fmt.Sprintf("conversation/gen_title/%s", conversationId)
-	response, err := runAPIRequest[GenerateConversationTitleResponse](g, http.MethodPost, endPoint, bytes.NewBuffer(requestBody))
+	response, err := runAPIRequest[GenerateConversationTitleResponse](ctx, g, http.MethodPost, endPoint, requestBody)
 	if err != nil {
 		return nil, err
 	}
@@ -309,6 +577,12 @@ func (g *gpt) GenerateTitle(conversationId, messageId string) ([]byte, error) {
 // Moderation checks for the text moderation for given conversationId, messageId and messageText.
 // It returns a TextModerationResponse and an error if something goes wrong
 func (g *gpt) Moderation(conversationId, messageId, messageText string) (*TextModerationResponse, error) {
+	return g.ModerationContext(context.Background(), conversationId, messageId, messageText)
+}
+
+// ModerationContext checks for the text moderation for given conversationId, messageId and messageText using the given
+// context.Context. It returns a TextModerationResponse and an error if something goes wrong
+func (g *gpt) ModerationContext(ctx context.Context, conversationId, messageId, messageText string) (*TextModerationResponse, error) {
 	requestBody, err := json.Marshal(internal.TextModerationRequestBody{
 		ConversationId: conversationId,
 		Input:          messageText,
@@ -316,11 +590,11 @@ func (g *gpt) Moderation(conversationId, messageId, messageText string) (*TextMo
 		Model:          "text-moderation-playground",
 	})
 	if err != nil {
-		logger.Error("Error while getting text moderation",
-			zap.String("conversationId", conversationId),
-			zap.String("messageId", messageText),
-			zap.String("messageText", messageText))
+		g.logger.Error("Error while getting text moderation",
+			zap.String("conversation-id", conversationId),
+			zap.String("message-id", messageId),
+			zap.String("message-text", messageText))
 		return nil, err
 	}
-	return runAPIRequest[TextModerationResponse](g, http.MethodPost, "moderations", bytes.NewBuffer(requestBody))
+	return runAPIRequest[TextModerationResponse](ctx, g, http.MethodPost, "moderations", requestBody)
 }
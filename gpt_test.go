@@ -0,0 +1,546 @@
+package gogpt_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Makepad-fr/gogpt"
+	"github.com/Makepad-fr/gogpt/gogpttest"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer starts a gogpttest.Server which is closed at the end of the test
+func newTestServer(t *testing.T) *gogpttest.Server {
+	t.Helper()
+	srv := gogpttest.NewServer()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testOptions returns the Options of the given gogpttest.Server with a fast retry policy and without logs
+func testOptions(srv *gogpttest.Server) gogpt.Options {
+	options := srv.Options()
+	options.Logger = zap.NewNop()
+	options.Retry = gogpt.RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	return options
+}
+
+// newLoggedInGPT creates a GoGPT instance with the given Options and logs it in. It is closed at the end of the test
+func newLoggedInGPT(t *testing.T, options gogpt.Options) gogpt.GoGPT {
+	t.Helper()
+	gpt, err := gogpt.New(options)
+	if err != nil {
+		t.Fatalf("New returned an error: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = gpt.Close()
+	})
+	err = gpt.Login("", "")
+	if err != nil {
+		t.Fatalf("Login returned an error: %v", err)
+	}
+	return gpt
+}
+
+// countRequests returns the number of requests received by the given gogpttest.Server on the given endpoint
+func countRequests(srv *gogpttest.Server, endpoint gogpttest.Endpoint) int {
+	count := 0
+	for _, request := range srv.Requests() {
+		if request.Endpoint == endpoint {
+			count++
+		}
+	}
+	return count
+}
+
+// decodeLastRequest decodes the body of the last request received by the given gogpttest.Server on the given endpoint
+func decodeLastRequest(t *testing.T, srv *gogpttest.Server, endpoint gogpttest.Endpoint, v interface{}) {
+	t.Helper()
+	requests := srv.Requests()
+	for i := len(requests) - 1; i >= 0; i-- {
+		if requests[i].Endpoint == endpoint {
+			if err := json.Unmarshal(requests[i].Body, v); err != nil {
+				t.Fatalf("can not decode the request on %s: %v", endpoint, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no request on %s", endpoint)
+}
+
+// sentMessage is the body of a request sending a message
+type sentMessage struct {
+	Action   string `json:"action"`
+	Messages []struct {
+		ID      string        `json:"id"`
+		Content gogpt.Content `json:"content"`
+	} `json:"messages"`
+	ParentMessageID string `json:"parent_message_id"`
+	Model           string `json:"model"`
+	ConversationID  string `json:"conversation_id"`
+}
+
+func TestLoginInitialisesTheSession(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	if got := gpt.Session().AccessToken; got != gogpttest.DefaultAccessToken {
+		t.Errorf("access token = %q, want %q", got, gogpttest.DefaultAccessToken)
+	}
+	if got := gpt.AccountInfo().UserCountry; got != "FR" {
+		t.Errorf("user country = %q, want %q", got, "FR")
+	}
+	for _, endpoint := range []gogpttest.Endpoint{gogpttest.EndpointSession, gogpttest.EndpointAccountsCheck, gogpttest.EndpointModels} {
+		if got := countRequests(srv, endpoint); got != 1 {
+			t.Errorf("%d requests on %s, want 1", got, endpoint)
+		}
+	}
+}
+
+func TestRunAPIRequestDecodesTheResponse(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetModels([]gogpt.ModelInfo{
+		{Slug: gogpttest.DefaultModel, MaxTokens: 4097},
+		{Slug: "gpt-4", MaxTokens: 8192},
+	})
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	models, err := gpt.Models()
+	if err != nil {
+		t.Fatalf("Models returned an error: %v", err)
+	}
+	if len(models) != 2 || models[1].Slug != "gpt-4" || models[1].MaxTokens != 8192 {
+		t.Errorf("models = %+v, want the models of the server", models)
+	}
+	for _, request := range srv.Requests() {
+		if request.Endpoint == gogpttest.EndpointModels && request.Method != http.MethodGet {
+			t.Errorf("models requested with %s, want GET", request.Method)
+		}
+	}
+}
+
+func TestRunAPIRequestReturnsAnAPIError(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	err := gpt.RenameConversation("unknown", "title")
+	var apiError *gogpt.APIError
+	if !errors.As(err, &apiError) {
+		t.Fatalf("RenameConversation returned %v, want an APIError", err)
+	}
+	if apiError.StatusCode != http.StatusNotFound || apiError.Detail != "Can't load conversation unknown" {
+		t.Errorf("APIError = %+v, want a 404 with the detail of the response", apiError)
+	}
+}
+
+func TestConversationLifecycle(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	conversation, err := gpt.CreateConversation("hello", gogpttest.DefaultModel, nil)
+	if err != nil {
+		t.Fatalf("CreateConversation returned an error: %v", err)
+	}
+	err = gpt.RenameConversation(conversation.ID, "renamed")
+	if err != nil {
+		t.Fatalf("RenameConversation returned an error: %v", err)
+	}
+	if stored, _ := srv.Conversation(conversation.ID); stored.Title != "renamed" {
+		t.Errorf("title = %q, want %q", stored.Title, "renamed")
+	}
+	loaded, err := gpt.LoadConversation(conversation.ID)
+	if err != nil {
+		t.Fatalf("LoadConversation returned an error: %v", err)
+	}
+	if got := len(loaded.ActiveThread()); got != 2 {
+		t.Errorf("%d messages in the active thread, want 2", got)
+	}
+	err = gpt.DeleteConversation(conversation.ID)
+	if err != nil {
+		t.Fatalf("DeleteConversation returned an error: %v", err)
+	}
+	if _, ok := srv.Conversation(conversation.ID); ok {
+		t.Error("the conversation is not deleted")
+	}
+}
+
+func TestHistoryLoadsAllPages(t *testing.T) {
+	srv := newTestServer(t)
+	const total = 250
+	for i := 0; i < total; i++ {
+		srv.AddConversation(gogpt.Conversation{Title: fmt.Sprintf("conversation %d", i)})
+	}
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	history, err := gpt.History()
+	if err != nil {
+		t.Fatalf("History returned an error: %v", err)
+	}
+	if len(history) != total {
+		t.Errorf("%d conversations in the history, want %d", len(history), total)
+	}
+	// The history is loaded by pages of 100 conversations
+	if got := countRequests(srv, gogpttest.EndpointConversations); got != 3 {
+		t.Errorf("%d requests on the conversations endpoint, want 3", got)
+	}
+}
+
+func TestHistoryRetriesEmptyPages(t *testing.T) {
+	srv := newTestServer(t)
+	// The total is greater than the number of returned conversations, as it happens with the real backend
+	srv.Handle(gogpttest.EndpointConversations, func(w http.ResponseWriter, r *http.Request) {
+		response := gogpt.ConversationHistoryResponse{Items: []gogpt.ConversationHistoryItem{}, Total: 10, Limit: 100}
+		if r.URL.Query().Get("offset") == "0" {
+			response.Items = append(response.Items, gogpt.ConversationHistoryItem{ID: "first"})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	})
+	options := testOptions(srv)
+	// Disabling the retries does not change the number of empty pages loaded before stopping
+	options.Retry.MaxAttempts = 1
+	gpt := newLoggedInGPT(t, options)
+
+	history, err := gpt.History()
+	if err != nil {
+		t.Fatalf("History returned an error: %v", err)
+	}
+	if len(history) != 1 {
+		t.Errorf("%d conversations in the history, want 1", len(history))
+	}
+	// The first page and the 5 empty pages
+	if got := countRequests(srv, gogpttest.EndpointConversations); got != 6 {
+		t.Errorf("%d requests on the conversations endpoint, want 6", got)
+	}
+}
+
+func TestInjectedFailuresAreRetried(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+	srv.InjectFailure(gogpttest.EndpointModels, gogpttest.Failure{StatusCode: http.StatusBadGateway, Times: 2})
+
+	_, err := gpt.Models()
+	if err != nil {
+		t.Fatalf("Models returned an error: %v", err)
+	}
+	// One request during the login, two failures and the successful retry
+	if got := countRequests(srv, gogpttest.EndpointModels); got != 4 {
+		t.Errorf("%d requests on the models endpoint, want 4", got)
+	}
+}
+
+func TestInjectedFailuresAreReturned(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	srv.InjectFailure(gogpttest.EndpointModels, gogpttest.Failure{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       `{"detail":"Too many requests"}`,
+		Times:      3,
+	})
+	_, err := gpt.Models()
+	if !errors.Is(err, gogpt.ErrRateLimited) {
+		t.Errorf("Models returned %v, want an error matching ErrRateLimited", err)
+	}
+
+	// A rejected request is sent again once after the renewal of the session
+	srv.InjectFailure(gogpttest.EndpointModels, gogpttest.Failure{StatusCode: http.StatusUnauthorized, Times: 2})
+	_, err = gpt.Models()
+	if !errors.Is(err, gogpt.ErrUnauthorized) {
+		t.Errorf("Models returned %v, want an error matching ErrUnauthorized", err)
+	}
+
+	// The messages are not idempotent, so they are not retried
+	before := countRequests(srv, gogpttest.EndpointSend)
+	srv.InjectFailure(gogpttest.EndpointSend, gogpttest.Failure{StatusCode: http.StatusBadGateway})
+	_, err = gpt.CreateConversation("hello", gogpttest.DefaultModel, nil)
+	if err == nil {
+		t.Fatal("CreateConversation succeeded, want an error")
+	}
+	if got := countRequests(srv, gogpttest.EndpointSend) - before; got != 1 {
+		t.Errorf("%d requests on the send endpoint, want 1", got)
+	}
+}
+
+func TestLatencyIsBoundedByTheContext(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+	srv.SetLatency(gogpttest.EndpointModels, 200*time.Millisecond)
+
+	start := time.Now()
+	_, err := gpt.Models()
+	if err != nil {
+		t.Fatalf("Models returned an error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Models returned after %s, want the latency of the server to be applied", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = gpt.ModelsContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ModelsContext returned %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRegenerateSendsAVariant(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+	created, err := gpt.CreateConversation("hello", gogpttest.DefaultModel, nil)
+	if err != nil {
+		t.Fatalf("CreateConversation returned an error: %v", err)
+	}
+	before, _ := srv.Conversation(created.ID)
+	previousResponse, _ := before.Node(before.CurrentNode)
+	userNode, _ := before.Node(previousResponse.Parent)
+
+	conversation, err := gpt.Regenerate(created.ID, gogpttest.DefaultModel, nil)
+	if err != nil {
+		t.Fatalf("Regenerate returned an error: %v", err)
+	}
+	var request sentMessage
+	decodeLastRequest(t, srv, gogpttest.EndpointSend, &request)
+	if request.Action != "variant" || request.ConversationID != created.ID {
+		t.Errorf("action = %q in conversation %q, want a variant in %q", request.Action, request.ConversationID, created.ID)
+	}
+	if len(request.Messages) != 1 || request.Messages[0].ID != userNode.ID {
+		t.Errorf("messages = %+v, want the user message %s", request.Messages, userNode.ID)
+	}
+	if request.ParentMessageID != userNode.Parent {
+		t.Errorf("parent message id = %q, want the parent %q of the user message", request.ParentMessageID, userNode.Parent)
+	}
+
+	currentNode, ok := conversation.Node(conversation.CurrentNode)
+	if !ok || conversation.CurrentNode == previousResponse.ID || currentNode.Parent != userNode.ID {
+		t.Fatalf("current node = %q, want a new response to the user message", conversation.CurrentNode)
+	}
+	if branches := conversation.Branches(userNode.ID); len(branches) != 2 || branches[1].ID != conversation.CurrentNode {
+		t.Errorf("%d responses to the user message, want the previous one and the regenerated one", len(branches))
+	}
+}
+
+func TestEditMessageCreatesANewBranch(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+	created, err := gpt.CreateConversation("hello", gogpttest.DefaultModel, nil)
+	if err != nil {
+		t.Fatalf("CreateConversation returned an error: %v", err)
+	}
+	if _, err := gpt.SendMessage(created.ID, "", "again", gogpttest.DefaultModel, nil); err != nil {
+		t.Fatalf("SendMessage returned an error: %v", err)
+	}
+	before, _ := srv.Conversation(created.ID)
+	thread := before.ActiveThread()
+	edited, _ := before.Node(thread[2].ID)
+
+	conversation, err := gpt.EditMessage(created.ID, edited.ID, "edited", gogpttest.DefaultModel, nil)
+	if err != nil {
+		t.Fatalf("EditMessage returned an error: %v", err)
+	}
+	var request sentMessage
+	decodeLastRequest(t, srv, gogpttest.EndpointSend, &request)
+	if request.Action != "next" || request.ParentMessageID != edited.Parent {
+		t.Errorf("action = %q with parent %q, want a new message under %q", request.Action, request.ParentMessageID, edited.Parent)
+	}
+
+	// The new message is a sibling of the edited message
+	siblings := conversation.Branches(edited.Parent)
+	if len(siblings) != 2 || siblings[0].ID != edited.ID || siblings[1].Content.Parts[0] != "edited" {
+		t.Fatalf("siblings = %+v, want the edited message and the new message", siblings)
+	}
+	// The new branch is the active thread
+	var texts []string
+	for _, message := range conversation.ActiveThread() {
+		texts = append(texts, message.Content.Parts[0])
+	}
+	want := "hello|You said: hello|edited|You said: edited"
+	if got := strings.Join(texts, "|"); got != want {
+		t.Errorf("active thread = %q, want %q", got, want)
+	}
+}
+
+func TestEditMessageRejectsUnknownMessages(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+	created, err := gpt.CreateConversation("hello", gogpttest.DefaultModel, nil)
+	if err != nil {
+		t.Fatalf("CreateConversation returned an error: %v", err)
+	}
+	before := countRequests(srv, gogpttest.EndpointSend)
+
+	_, err = gpt.EditMessage(created.ID, "unknown", "edited", gogpttest.DefaultModel, nil)
+	if err == nil || !strings.Contains(err.Error(), "can not find message unknown") {
+		t.Errorf("EditMessage returned %v, want an error for the unknown message", err)
+	}
+	stored, _ := srv.Conversation(created.ID)
+	_, err = gpt.EditMessage(created.ID, stored.CurrentNode, "edited", gogpttest.DefaultModel, nil)
+	if err == nil || !strings.Contains(err.Error(), "is not a user message") {
+		t.Errorf("EditMessage returned %v for a response of the assistant, want an error", err)
+	}
+	if got := countRequests(srv, gogpttest.EndpointSend); got != before {
+		t.Errorf("%d messages sent, want none", got-before)
+	}
+}
+
+// historyIDs returns the ids of the conversations of the history of the given GoGPT instance
+func historyIDs(t *testing.T, gpt gogpt.GoGPT) map[string]bool {
+	t.Helper()
+	history, err := gpt.History()
+	if err != nil {
+		t.Fatalf("History returned an error: %v", err)
+	}
+	ids := make(map[string]bool, len(history))
+	for _, item := range history {
+		ids[item.ID] = true
+	}
+	return ids
+}
+
+func TestArchiveAndDeleteUpdateTheHistory(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+	var ids []string
+	for i := 0; i < 3; i++ {
+		conversation, err := gpt.CreateConversation(fmt.Sprintf("conversation %d", i), gogpttest.DefaultModel, nil)
+		if err != nil {
+			t.Fatalf("CreateConversation returned an error: %v", err)
+		}
+		ids = append(ids, conversation.ID)
+	}
+	if got := historyIDs(t, gpt); len(got) != 3 {
+		t.Fatalf("%d conversations in the history, want 3", len(got))
+	}
+
+	if err := gpt.ArchiveConversation(ids[0]); err != nil {
+		t.Fatalf("ArchiveConversation returned an error: %v", err)
+	}
+	if got := historyIDs(t, gpt); len(got) != 2 || got[ids[0]] {
+		t.Errorf("history = %v after the archive, want the 2 other conversations", got)
+	}
+	if err := gpt.DeleteConversation(ids[1]); err != nil {
+		t.Fatalf("DeleteConversation returned an error: %v", err)
+	}
+	if got := historyIDs(t, gpt); len(got) != 1 || !got[ids[2]] {
+		t.Errorf("history = %v after the deletion, want the last conversation", got)
+	}
+	if _, err := gpt.LoadConversation(ids[1]); err == nil {
+		t.Error("LoadConversation returned a deleted conversation")
+	}
+
+	if err := gpt.DeleteAllConversations(); err != nil {
+		t.Fatalf("DeleteAllConversations returned an error: %v", err)
+	}
+	if got := historyIDs(t, gpt); len(got) != 0 {
+		t.Errorf("history = %v after the deletion of all conversations, want it empty", got)
+	}
+}
+
+func TestShareConversation(t *testing.T) {
+	srv := newTestServer(t)
+	gpt := newLoggedInGPT(t, testOptions(srv))
+	conversation, err := gpt.CreateConversation("hello", gogpttest.DefaultModel, nil)
+	if err != nil {
+		t.Fatalf("CreateConversation returned an error: %v", err)
+	}
+	stored, _ := srv.Conversation(conversation.ID)
+
+	share, err := gpt.ShareConversation(conversation.ID, true)
+	if err != nil {
+		t.Fatalf("ShareConversation returned an error: %v", err)
+	}
+	if share.ShareID == "" || share.ShareURL != srv.URL()+"/share/"+share.ShareID {
+		t.Errorf("share id = %q and url = %q, want the link created by the server", share.ShareID, share.ShareURL)
+	}
+	if !share.IsPublic || !share.IsAnonymous || share.HighlightedMessageID != stored.CurrentNode {
+		t.Errorf("share = %+v, want a public anonymous link to the current node", share)
+	}
+	// The link is created, then made public
+	if got := countRequests(srv, gogpttest.EndpointShare); got != 2 {
+		t.Errorf("%d requests on the share endpoint, want 2", got)
+	}
+	var update struct {
+		IsPublic bool `json:"is_public"`
+	}
+	decodeLastRequest(t, srv, gogpttest.EndpointShare, &update)
+	if !update.IsPublic {
+		t.Error("the shared link is not made public")
+	}
+}
+
+// paidAccountInfo returns the information of an account with an active paid subscription
+func paidAccountInfo() gogpt.UserAccountInfo {
+	return gogpt.UserAccountInfo{
+		AccountPlan: gogpt.AccountPlan{IsPaidSubscriptionActive: true, SubscriptionPlan: "chatgptplusplan"},
+		UserCountry: "FR",
+	}
+}
+
+func TestAskUsesTheModelOfTheVersion(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetAccountInfo(paidAccountInfo())
+	srv.SetModels([]gogpt.ModelInfo{
+		{Slug: "text-davinci-002-render-sha"},
+		{Slug: "text-davinci-002-render-paid"},
+		// The first model of the version is not available
+		{Slug: "gpt-4-browsing"},
+	})
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	tests := []struct {
+		version gogpt.Version
+		want    string
+	}{
+		{gogpt.V4, "gpt-4-browsing"},
+		{gogpt.V3_5, "text-davinci-002-render-sha"},
+		{gogpt.V3Legacy, "text-davinci-002-render-paid"},
+	}
+	for _, test := range tests {
+		answer, conversationID, err := gpt.Ask("hello", test.version)
+		if err != nil {
+			t.Fatalf("Ask returned an error for %s: %v", test.version, err)
+		}
+		if answer != "You said: hello" || conversationID == "" {
+			t.Errorf("Ask returned %q in conversation %q for %s, want the answer of the server", answer, conversationID, test.version)
+		}
+		var request sentMessage
+		decodeLastRequest(t, srv, gogpttest.EndpointSend, &request)
+		if request.Model != test.want {
+			t.Errorf("model used for %s = %q, want %q", test.version, request.Model, test.want)
+		}
+	}
+}
+
+func TestAskRequiresAPaidSubscription(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetModels([]gogpt.ModelInfo{{Slug: "text-davinci-002-render-sha"}, {Slug: "gpt-4"}})
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	for _, version := range []gogpt.Version{gogpt.V4, gogpt.V3Legacy} {
+		if _, _, err := gpt.Ask("hello", version); !errors.Is(err, gogpt.ErrPaidSubscriptionRequired) {
+			t.Errorf("Ask returned %v for %s without a paid subscription, want ErrPaidSubscriptionRequired", err, version)
+		}
+	}
+	if got := countRequests(srv, gogpttest.EndpointSend); got != 0 {
+		t.Errorf("%d messages sent without a paid subscription, want none", got)
+	}
+	if _, _, err := gpt.Ask("hello", gogpt.V3_5); err != nil {
+		t.Errorf("Ask returned %v for %s, want no error", err, gogpt.V3_5)
+	}
+}
+
+func TestAskWithoutTheModelOfTheVersion(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetAccountInfo(paidAccountInfo())
+	srv.SetModels([]gogpt.ModelInfo{{Slug: "text-davinci-002-render-sha"}})
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	if _, _, err := gpt.Ask("hello", gogpt.V4); !errors.Is(err, gogpt.ErrModelNotFound) {
+		t.Errorf("Ask returned %v without a model of %s, want ErrModelNotFound", err, gogpt.V4)
+	}
+}
@@ -1,10 +1,14 @@
 package gogpt
 
+import "sync"
+
 type idBasedItem interface {
 	getId() string
 }
 
+// idBasedSet is a set of items identified by their ids. It is safe for concurrent use
 type idBasedSet[T idBasedItem] struct {
+	mu      sync.RWMutex
 	Content []T
 }
 
@@ -17,7 +21,14 @@ func newIdBasedSet[T idBasedItem](capacity int) *idBasedSet[T] {
 
 // add adds the given element to the current idBasedSet instance
 func (s *idBasedSet[T]) add(itemToAdd T) bool {
-	if s.contains(itemToAdd) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addUnlocked(itemToAdd)
+}
+
+// addUnlocked adds the given element to the current idBasedSet instance. The caller must hold the write lock
+func (s *idBasedSet[T]) addUnlocked(itemToAdd T) bool {
+	if s.indexOf(itemToAdd.getId()) >= 0 {
 		return false
 	}
 	s.Content = append(s.Content, itemToAdd)
@@ -26,32 +37,88 @@ func (s *idBasedSet[T]) add(itemToAdd T) bool {
 
 // addAll adds the given list of elements in tho the current idBasedSet instance
 func (s *idBasedSet[T]) addAll(itemsToAdd []T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for _, itemToAdd := range itemsToAdd {
-		s.add(itemToAdd)
+		s.addUnlocked(itemToAdd)
 	}
 }
 
-// contains check if the given item is in the current idBasedSet instance or not
-func (s *idBasedSet[T]) contains(itemToVerify T) bool {
-	for _, item := range s.Content {
-		if item.getId() == itemToVerify.getId() {
-			return true
+// indexOf returns the index of the element which has the given id, or -1 if there's no element with the given id.
+// The caller must hold the lock
+func (s *idBasedSet[T]) indexOf(id string) int {
+	for i, item := range s.Content {
+		if item.getId() == id {
+			return i
 		}
 	}
-	return false
+	return -1
+}
+
+// contains check if the given item is in the current idBasedSet instance or not
+func (s *idBasedSet[T]) contains(itemToVerify T) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.indexOf(itemToVerify.getId()) >= 0
 }
 
 // find finds the element which has the given id in the current idBasedSet
 func (s *idBasedSet[T]) find(id string) *T {
-	for _, item := range s.Content {
-		if item.getId() == id {
-			return &item
-		}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.indexOf(id)
+	if i < 0 {
+		return nil
+	}
+	item := s.Content[i]
+	return &item
+}
+
+// update replaces the element which has the same id as the given item in the current idBasedSet. It returns false if
+// there's no element with the same id
+func (s *idBasedSet[T]) update(itemToUpdate T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(itemToUpdate.getId())
+	if i < 0 {
+		return false
 	}
-	return nil
+	s.Content[i] = itemToUpdate
+	return true
+}
+
+// remove removes the element which has the given id from the current idBasedSet. It returns false if there's no
+// element with the given id
+func (s *idBasedSet[T]) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(id)
+	if i < 0 {
+		return false
+	}
+	s.Content = append(s.Content[:i], s.Content[i+1:]...)
+	return true
+}
+
+// clear removes all elements of the current idBasedSet
+func (s *idBasedSet[T]) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Content = s.Content[:0]
+}
+
+// items returns a copy of the elements of the current idBasedSet
+func (s *idBasedSet[T]) items() []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]T, len(s.Content))
+	copy(items, s.Content)
+	return items
 }
 
 // size returns the length of the idBasedSet instance
 func (s *idBasedSet[T]) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return len(s.Content)
 }
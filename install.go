@@ -0,0 +1,159 @@
+package gogpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/playwright-community/playwright-go"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// playwrightBrowsersPathEnv is the environment variable used by the playwright driver to find the browsers
+const playwrightBrowsersPathEnv = "PLAYWRIGHT_BROWSERS_PATH"
+
+// playwrightDownloadHost is the host used by playwright to download the driver and the browsers
+const playwrightDownloadHost = "playwright.azureedge.net"
+
+// defaultBrowsers is the list of browsers used by gogpt
+var defaultBrowsers = []string{"firefox"}
+
+// ErrBrowsersNotInstalled is returned when the playwright driver or the browsers are not installed
+var ErrBrowsersNotInstalled = errors.New("playwright driver or browsers are not installed, use InstallBrowsers to install them")
+
+// ErrOffline is returned when the playwright driver or the browsers need to be downloaded but the network is not reachable
+var ErrOffline = errors.New("network is not reachable to download the playwright driver or browsers")
+
+// BrowsersNotInstalledError is returned by New when the playwright driver or the browsers are not installed.
+// It matches ErrBrowsersNotInstalled using errors.Is
+type BrowsersNotInstalledError struct {
+	// DriverDirectory is the directory where the playwright driver is expected
+	DriverDirectory string
+	// Err is the underlying error
+	Err error
+}
+
+// Error returns the description of the current BrowsersNotInstalledError
+func (e *BrowsersNotInstalledError) Error() string {
+	return fmt.Sprintf("%s (driver directory %s): %v", ErrBrowsersNotInstalled, e.DriverDirectory, e.Err)
+}
+
+// Unwrap returns the underlying error of the current BrowsersNotInstalledError
+func (e *BrowsersNotInstalledError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if the given target is ErrBrowsersNotInstalled
+func (e *BrowsersNotInstalledError) Is(target error) bool {
+	return target == ErrBrowsersNotInstalled
+}
+
+// InstallOptions defines where the playwright driver and the browsers are installed by InstallBrowsers, and where
+// they are searched by New and DumpCookie
+type InstallOptions struct {
+	// Browsers is the list of browsers to install. Only firefox is installed if it is empty
+	Browsers []string
+	// DriverDirectory is the directory where the playwright driver is installed. The default cache directory of the
+	// user is used if it is empty
+	DriverDirectory string
+	// BrowsersPath is the directory where the browsers are installed. If it is not empty, it sets the
+	// PLAYWRIGHT_BROWSERS_PATH environment variable used by the playwright driver
+	BrowsersPath string
+	// Verbose enables the logs of the installation
+	Verbose bool
+}
+
+// runOptions returns the playwright.RunOptions related to the current InstallOptions
+func (o InstallOptions) runOptions() *playwright.RunOptions {
+	browsers := o.Browsers
+	if len(browsers) == 0 {
+		browsers = defaultBrowsers
+	}
+	return &playwright.RunOptions{
+		DriverDirectory: o.DriverDirectory,
+		Browsers:        browsers,
+		Verbose:         o.Verbose,
+	}
+}
+
+// setBrowsersPath sets the PLAYWRIGHT_BROWSERS_PATH environment variable if the BrowsersPath is not empty
+func (o InstallOptions) setBrowsersPath() error {
+	if isEmpty(o.BrowsersPath) {
+		return nil
+	}
+	return os.Setenv(playwrightBrowsersPathEnv, o.BrowsersPath)
+}
+
+// InstallBrowsers installs the playwright driver and the browsers using the given InstallOptions. It returns an error
+// wrapping ErrOffline if the files need to be downloaded while the network is not reachable
+func InstallBrowsers(options InstallOptions) error {
+	err := options.setBrowsersPath()
+	if err != nil {
+		return err
+	}
+	runOptions := options.runOptions()
+	driver, err := playwright.NewDriver(runOptions)
+	if err != nil {
+		return err
+	}
+	_, driverErr := os.Stat(driver.DriverBinaryLocation)
+	if driverErr != nil && !isNetworkReachable() {
+		return fmt.Errorf("can not install the playwright driver in %s: %w", driver.DriverDirectory, ErrOffline)
+	}
+	err = playwright.Install(runOptions)
+	if err != nil {
+		if !isNetworkReachable() {
+			return fmt.Errorf("%v: %w", err, ErrOffline)
+		}
+		return err
+	}
+	return nil
+}
+
+// runPlaywright starts the playwright driver using the given InstallOptions. It returns a *BrowsersNotInstalledError
+// if the driver is not installed
+func runPlaywright(options InstallOptions) (*playwright.Playwright, error) {
+	err := options.setBrowsersPath()
+	if err != nil {
+		return nil, err
+	}
+	runOptions := options.runOptions()
+	driver, err := playwright.NewDriver(runOptions)
+	if err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(driver.DriverBinaryLocation)
+	if err != nil {
+		return nil, &BrowsersNotInstalledError{DriverDirectory: driver.DriverDirectory, Err: err}
+	}
+	pw, err := playwright.Run(runOptions)
+	if err != nil {
+		return nil, &BrowsersNotInstalledError{DriverDirectory: driver.DriverDirectory, Err: err}
+	}
+	return pw, nil
+}
+
+// driverDirectory returns the directory of the playwright driver related to the given InstallOptions
+func (o InstallOptions) driverDirectory() string {
+	driver, err := playwright.NewDriver(o.runOptions())
+	if err != nil {
+		return o.DriverDirectory
+	}
+	return driver.DriverDirectory
+}
+
+// isBrowserNotInstalledError returns true if the given error returned by playwright while launching a browser
+// indicates that the browser is not installed
+func isBrowserNotInstalledError(err error) bool {
+	return strings.Contains(err.Error(), "Executable doesn't exist") || strings.Contains(err.Error(), "playwright install")
+}
+
+// isNetworkReachable returns true if the host used to download the playwright driver and browsers can be resolved
+func isNetworkReachable() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := net.DefaultResolver.LookupHost(ctx, playwrightDownloadHost)
+	return err == nil
+}
@@ -0,0 +1,145 @@
+package gogpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/playwright-community/playwright-go"
+	"time"
+)
+
+// defaultInteractiveLoginTimeout is the default duration the user has to log in with DumpCookie
+const defaultInteractiveLoginTimeout = 10 * time.Minute
+
+var (
+	// ErrInteractiveLoginAborted is returned by DumpCookie when the browser is closed before the end of the login
+	ErrInteractiveLoginAborted = errors.New("the browser was closed before the end of the login")
+	// ErrInteractiveLoginTimeout is returned by DumpCookie when the user does not log in before the timeout
+	ErrInteractiveLoginTimeout = errors.New("the login was not completed before the timeout")
+)
+
+// DumpCookieOptions are the options of an interactive login with DumpCookieContext
+type DumpCookieOptions struct {
+	// BrowserContextPath is the path of the file where the storage state of the browser is written. It is not used if
+	// CredentialStore is set
+	BrowserContextPath string
+	// CredentialStore is the CredentialStore where the storage state of the browser is saved, if it is not nil
+	CredentialStore CredentialStore
+	// BaseURL is the URL of ChatGPT. It defaults to https://chat.openai.com
+	BaseURL string
+	// Install is the InstallOptions used to find the playwright driver and browsers installed using InstallBrowsers
+	Install InstallOptions
+	// Timeout is the duration the user has to log in. It defaults to 10 minutes
+	Timeout time.Duration
+}
+
+// DumpCookieResult describes the session dumped by DumpCookieContext
+type DumpCookieResult struct {
+	// Path is the path of the file containing the storage state. It is empty if it is saved to a CredentialStore
+	Path string
+	// URL is the URL of the page once the user is logged in
+	URL string
+	// Cookies is the number of saved cookies
+	Cookies int
+	// SessionTokenFound is true if the session token cookie of the ChatGPT account is saved
+	SessionTokenFound bool
+	// SessionTokenExpires is the expiration time of the session token cookie, if it is found
+	SessionTokenExpires time.Time
+	// Duration is the time the user took to log in
+	Duration time.Duration
+}
+
+// DumpCookie opens a browser window to let the user log in to ChatGPT with any login method, such as Google,
+// Microsoft, SSO or multi-factor authentication. Once the user is logged in, it dumps the browser context to the given
+// browserContextPath, which can be used as the BrowserContextPath of the Options. Use DumpCookieContext to get the
+// DumpCookieResult describing the dumped session
+func DumpCookie(browserContextPath string) error {
+	_, err := DumpCookieContext(context.Background(), DumpCookieOptions{BrowserContextPath: browserContextPath})
+	return err
+}
+
+// DumpCookieContext opens a browser window to let the user log in to ChatGPT with any login method using the given
+// DumpCookieOptions. Once the user arrives on the chat page, it saves the storage state of the browser. It returns
+// ErrInteractiveLoginAborted if the browser is closed, and ErrInteractiveLoginTimeout or the error of the given
+// context.Context if the user does not log in in time
+func DumpCookieContext(ctx context.Context, options DumpCookieOptions) (*DumpCookieResult, error) {
+	if options.CredentialStore == nil && isEmpty(options.BrowserContextPath) {
+		return nil, errors.New("either the browser context path or the credential store should be provided")
+	}
+	baseURL := Options{BaseURL: options.BaseURL}.baseURL()
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultInteractiveLoginTimeout
+	}
+	contextOptions, err := newBrowserContextOptions(Options{
+		BrowserContextPath: options.BrowserContextPath,
+		CredentialStore:    options.CredentialStore,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pw, err := runPlaywright(options.Install)
+	if err != nil {
+		return nil, err
+	}
+	defer pw.Stop()
+	browser, err := launchBrowser(pw, options.Install, false)
+	if err != nil {
+		return nil, err
+	}
+	defer browser.Close()
+	page, err := browser.NewPage(contextOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	_, err = page.Goto(baseURL, playwright.PageGotoOptions{Timeout: playwrightTimeout(ctx, nil)})
+	if err != nil {
+		return nil, interactiveLoginError(ctx, page, err)
+	}
+	timeoutMilliseconds := float64(timeout.Milliseconds())
+	err = page.WaitForURL(fmt.Sprintf("%s/chat**", baseURL), playwright.FrameWaitForURLOptions{
+		Timeout: playwrightTimeout(ctx, &timeoutMilliseconds),
+	})
+	if err != nil {
+		return nil, interactiveLoginError(ctx, page, err)
+	}
+
+	state, err := saveStorageState(page.Context(), options.CredentialStore, options.BrowserContextPath)
+	if err != nil {
+		return nil, err
+	}
+	result := &DumpCookieResult{
+		URL:      page.URL(),
+		Cookies:  len(state.Cookies),
+		Duration: time.Since(start),
+	}
+	if options.CredentialStore == nil {
+		result.Path = options.BrowserContextPath
+	}
+	for _, cookie := range state.Cookies {
+		if cookie.Name == sessionTokenCookieName {
+			result.SessionTokenFound = true
+			if cookie.Expires > 0 {
+				result.SessionTokenExpires = time.Unix(int64(cookie.Expires), 0)
+			}
+		}
+	}
+	return result, nil
+}
+
+// interactiveLoginError returns the error to return when the given error occurs while waiting for the user to log in
+func interactiveLoginError(ctx context.Context, page playwright.Page, err error) error {
+	if page.IsClosed() {
+		return ErrInteractiveLoginAborted
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var timeoutError *playwright.TimeoutError
+	if errors.As(err, &timeoutError) {
+		return fmt.Errorf("%w: %v", ErrInteractiveLoginTimeout, err)
+	}
+	return err
+}
@@ -18,7 +18,7 @@ type GenerateConversationTitleRequestBody struct {
 
 type NewMessageRequest struct {
 	Action            string    `json:"action"`
-	Messages          []Message `json:"messages"`
+	Messages          []Message `json:"messages,omitempty"`
 	ParentMessageID   string    `json:"parent_message_id"`
 	Model             string    `json:"model"`
 	TimezoneOffsetMin int       `json:"timezone_offset_min"`
@@ -48,3 +48,24 @@ type Message struct {
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 	Recipient  string                 `json:"recipient,omitempty"`
 }
+
+type UpdateConversationRequestBody struct {
+	Title      *string `json:"title,omitempty"`
+	IsVisible  *bool   `json:"is_visible,omitempty"`
+	IsArchived *bool   `json:"is_archived,omitempty"`
+}
+
+type CreateShareRequestBody struct {
+	ConversationId string `json:"conversation_id"`
+	CurrentNodeId  string `json:"current_node_id"`
+	IsAnonymous    bool   `json:"is_anonymous"`
+}
+
+type UpdateShareRequestBody struct {
+	ShareId              string `json:"share_id"`
+	HighlightedMessageId string `json:"highlighted_message_id,omitempty"`
+	Title                string `json:"title"`
+	IsPublic             bool   `json:"is_public"`
+	IsVisible            bool   `json:"is_visible"`
+	IsAnonymous          bool   `json:"is_anonymous"`
+}
@@ -0,0 +1,15 @@
+package gogpt
+
+import "github.com/Makepad-fr/gogpt/internal"
+
+// Message is a message of a conversation, sent either by the user or by the assistant
+type Message = internal.Message
+
+// Author is the author of a Message
+type Author = internal.Author
+
+// Content is the content of a Message
+type Content = internal.Content
+
+// MappingNode is a node of the tree of messages of a Conversation
+type MappingNode = internal.MappingNode
@@ -0,0 +1,210 @@
+package gogpt
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimit is a token bucket limit allowing Requests requests per duration Per, with bursts of up to Burst requests
+type RateLimit struct {
+	// Requests is the number of requests allowed per duration Per
+	Requests uint
+	// Per is the duration in which Requests requests are allowed
+	Per time.Duration
+	// Burst is the maximum number of requests which can be sent at once. It defaults to 1
+	Burst uint
+}
+
+// RateLimitOptions defines the client-side limits applied to the requests of a GoGPT instance. The requests waiting
+// for a limit are blocked until the limit allows them or until their context.Context is done
+type RateLimitOptions struct {
+	// Messages limits the requests sending a message to a conversation. There is no limit if it is nil
+	Messages *RateLimit
+	// Reads limits the requests reading the metadata, such as the history, the conversations, the models or the
+	// account. There is no limit if it is nil
+	Reads *RateLimit
+	// MaxInFlight is the maximum number of requests sent at the same time. A request sending a message is in flight
+	// until its response is received, the event stream is not taken into account while it is being read. There is no
+	// limit if it is 0
+	MaxInFlight uint
+}
+
+// Metrics contains the statistics of the requests sent by a GoGPT instance
+type Metrics struct {
+	// InFlight is the number of requests currently sent
+	InFlight int64
+	// Queued is the number of requests currently waiting for a rate limit or for the MaxInFlight limit
+	Queued int64
+	// Requests is the total number of requests sent
+	Requests uint64
+	// Throttled is the total number of requests which waited for a rate limit or for the MaxInFlight limit
+	Throttled uint64
+	// WaitTime is the total time spent by the requests waiting for a rate limit or for the MaxInFlight limit
+	WaitTime time.Duration
+}
+
+// requestClass identifies the rate limit applied to a request
+type requestClass int
+
+const (
+	requestClassOther requestClass = iota
+	requestClassMessage
+	requestClassRead
+)
+
+// requestClassOf returns the requestClass of the request sent with the given method on the given endpoint
+func requestClassOf(method, endpoint string) requestClass {
+	if method == http.MethodPost && endpoint == "conversation" {
+		return requestClassMessage
+	}
+	if method == http.MethodGet {
+		return requestClassRead
+	}
+	return requestClassOther
+}
+
+// tokenBucket is a token bucket rate limiter which is safe for concurrent use
+type tokenBucket struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket creates a new tokenBucket for the given RateLimit. It returns nil if the RateLimit is nil or does not
+// allow any request
+func newTokenBucket(limit *RateLimit) *tokenBucket {
+	if limit == nil || limit.Requests == 0 || limit.Per <= 0 {
+		return nil
+	}
+	burst := float64(limit.Burst)
+	if burst == 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		interval: limit.Per / time.Duration(limit.Requests),
+		burst:    burst,
+		tokens:   burst,
+		last:     time.Now(),
+	}
+}
+
+// reserve takes a token from the current tokenBucket and returns the delay to wait before using it
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+float64(now.Sub(b.last))/float64(b.interval))
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.interval))
+}
+
+// cancel gives back a token taken by reserve which is not used
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// requestLimiter applies the RateLimitOptions to the requests and collects their Metrics
+type requestLimiter struct {
+	messages  *tokenBucket
+	reads     *tokenBucket
+	slots     chan struct{}
+	inFlight  atomic.Int64
+	queued    atomic.Int64
+	requests  atomic.Uint64
+	throttled atomic.Uint64
+	waitTime  atomic.Int64
+}
+
+// newRequestLimiter creates a new requestLimiter with the given RateLimitOptions
+func newRequestLimiter(options RateLimitOptions) *requestLimiter {
+	limiter := &requestLimiter{
+		messages: newTokenBucket(options.Messages),
+		reads:    newTokenBucket(options.Reads),
+	}
+	if options.MaxInFlight > 0 {
+		limiter.slots = make(chan struct{}, options.MaxInFlight)
+	}
+	return limiter
+}
+
+// bucket returns the tokenBucket applied to the given requestClass, or nil if there is no rate limit
+func (l *requestLimiter) bucket(class requestClass) *tokenBucket {
+	switch class {
+	case requestClassMessage:
+		return l.messages
+	case requestClassRead:
+		return l.reads
+	}
+	return nil
+}
+
+// acquire waits for the rate limit of the given requestClass and for a free slot of the MaxInFlight limit. It returns
+// a function which must be called once the request is done, or the error of the given context.Context if it is done
+// while waiting
+func (l *requestLimiter) acquire(ctx context.Context, class requestClass) (func(), error) {
+	start := time.Now()
+	waited := false
+	l.queued.Add(1)
+	defer func() {
+		l.queued.Add(-1)
+		if waited {
+			l.throttled.Add(1)
+			l.waitTime.Add(int64(time.Since(start)))
+		}
+	}()
+	if bucket := l.bucket(class); bucket != nil {
+		if delay := bucket.reserve(); delay > 0 {
+			waited = true
+			if err := sleepContext(ctx, delay); err != nil {
+				bucket.cancel()
+				return nil, err
+			}
+		}
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			waited = true
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	l.requests.Add(1)
+	l.inFlight.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.inFlight.Add(-1)
+			if l.slots != nil {
+				<-l.slots
+			}
+		})
+	}, nil
+}
+
+// metrics returns the current Metrics of the requestLimiter
+func (l *requestLimiter) metrics() Metrics {
+	return Metrics{
+		InFlight:  l.inFlight.Load(),
+		Queued:    l.queued.Load(),
+		Requests:  l.requests.Load(),
+		Throttled: l.throttled.Load(),
+		WaitTime:  time.Duration(l.waitTime.Load()),
+	}
+}
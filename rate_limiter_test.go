@@ -0,0 +1,152 @@
+package gogpt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewTokenBucketWithoutLimit(t *testing.T) {
+	limits := []*RateLimit{nil, {Requests: 0, Per: time.Second}, {Requests: 1, Per: 0}}
+	for _, limit := range limits {
+		if bucket := newTokenBucket(limit); bucket != nil {
+			t.Errorf("newTokenBucket(%+v) = %+v, want nil", limit, bucket)
+		}
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	// The interval is long enough to not refill the bucket during the test
+	bucket := newTokenBucket(&RateLimit{Requests: 1, Per: time.Hour, Burst: 2})
+	for i := 0; i < 2; i++ {
+		if delay := bucket.reserve(); delay != 0 {
+			t.Errorf("delay of the request %d of the burst = %s, want 0", i, delay)
+		}
+	}
+	delay := bucket.reserve()
+	if delay < 59*time.Minute || delay > time.Hour {
+		t.Errorf("delay after the burst = %s, want about 1h", delay)
+	}
+	// A cancelled reservation does not delay the next one
+	bucket.cancel()
+	if next := bucket.reserve(); next > delay {
+		t.Errorf("delay after a cancelled reservation = %s, want at most %s", next, delay)
+	}
+	if requests := newTokenBucket(&RateLimit{Requests: 4, Per: time.Second}); requests.interval != 250*time.Millisecond || requests.burst != 1 {
+		t.Errorf("interval = %s and burst = %v, want 250ms and 1", requests.interval, requests.burst)
+	}
+}
+
+func TestRequestClassOf(t *testing.T) {
+	tests := []struct {
+		method, endpoint string
+		want             requestClass
+	}{
+		{http.MethodPost, "conversation", requestClassMessage},
+		{http.MethodGet, "conversations", requestClassRead},
+		{http.MethodGet, "models", requestClassRead},
+		{http.MethodPatch, "conversation/id", requestClassOther},
+		{http.MethodPost, "conversation/gen_title/id", requestClassOther},
+	}
+	for _, test := range tests {
+		if got := requestClassOf(test.method, test.endpoint); got != test.want {
+			t.Errorf("requestClassOf(%s, %s) = %v, want %v", test.method, test.endpoint, got, test.want)
+		}
+	}
+}
+
+func TestRequestLimiterWaitsForTheRateLimit(t *testing.T) {
+	limiter := newRequestLimiter(RateLimitOptions{Reads: &RateLimit{Requests: 1, Per: 50 * time.Millisecond}})
+	release, err := limiter.acquire(context.Background(), requestClassRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	// The other requests are not limited by the rate limit of the reads
+	release, err = limiter.acquire(context.Background(), requestClassOther)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	start := time.Now()
+	release, err = limiter.acquire(context.Background(), requestClassRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("second read acquired after %s, want about 50ms", elapsed)
+	}
+
+	metrics := limiter.metrics()
+	if metrics.Requests != 3 || metrics.Throttled != 1 || metrics.InFlight != 0 || metrics.Queued != 0 {
+		t.Errorf("metrics = %+v, want 3 requests and 1 throttled", metrics)
+	}
+	if metrics.WaitTime < 40*time.Millisecond {
+		t.Errorf("wait time = %s, want about 50ms", metrics.WaitTime)
+	}
+}
+
+func TestRequestLimiterIsCancelledByTheContext(t *testing.T) {
+	limiter := newRequestLimiter(RateLimitOptions{Messages: &RateLimit{Requests: 1, Per: time.Hour}})
+	if _, err := limiter.acquire(context.Background(), requestClassMessage); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, requestClassMessage); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("acquire returned %v, want context.DeadlineExceeded", err)
+	}
+	metrics := limiter.metrics()
+	if metrics.Requests != 1 || metrics.Throttled != 1 || metrics.Queued != 0 {
+		t.Errorf("metrics = %+v, want 1 request and 1 throttled", metrics)
+	}
+}
+
+func TestRequestLimiterMaxInFlight(t *testing.T) {
+	limiter := newRequestLimiter(RateLimitOptions{MaxInFlight: 1})
+	release, err := limiter.acquire(context.Background(), requestClassOther)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		next, err := limiter.acquire(context.Background(), requestClassOther)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- next
+	}()
+	for limiter.metrics().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The cancellation stops the wait of a free slot
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, requestClassOther); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("acquire returned %v, want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-acquired:
+		t.Fatal("a second request is in flight")
+	default:
+	}
+	if metrics := limiter.metrics(); metrics.InFlight != 1 || metrics.Queued != 1 {
+		t.Errorf("metrics = %+v, want 1 request in flight and 1 queued", metrics)
+	}
+
+	release()
+	// The release function can be called more than once
+	release()
+	next := <-acquired
+	if metrics := limiter.metrics(); metrics.InFlight != 1 || metrics.Queued != 0 || metrics.Requests != 2 || metrics.Throttled != 2 {
+		t.Errorf("metrics = %+v, want 1 request in flight, 2 requests and 2 throttled", metrics)
+	}
+	next()
+	if metrics := limiter.metrics(); metrics.InFlight != 0 {
+		t.Errorf("%d requests in flight after the release, want 0", metrics.InFlight)
+	}
+}
@@ -0,0 +1,272 @@
+package gogpt
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces the redacted values in the logs
+const redactedValue = "[REDACTED]"
+
+// LogRedaction is the policy used to redact the sensitive data from the logs. Its zero value redacts the tokens, the
+// cookies, the passwords and the email addresses, and keeps the content of the prompts and the responses
+type LogRedaction struct {
+	// KeepSecrets disables the redaction of the access tokens, the session tokens, the cookies and the passwords
+	KeepSecrets bool
+	// KeepEmails disables the redaction of the email addresses
+	KeepEmails bool
+	// RedactContent enables the redaction of the content of the prompts, the responses and the request bodies
+	RedactContent bool
+}
+
+var (
+	// secretFieldKeyParts are the parts of the log field keys whose values are secrets
+	secretFieldKeyParts = []string{"token", "cookie", "authorization", "password", "secret"}
+	// contentFieldKeys are the log field keys whose values contain prompts or responses
+	contentFieldKeys = map[string]bool{
+		"body":         true,
+		"current-line": true,
+		"line":         true,
+		"message-text": true,
+		"request-body": true,
+		"response":     true,
+		"title":        true,
+	}
+	bearerTokenRegexp  = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`)
+	jwtRegexp          = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	secretJSONRegexp   = regexp.MustCompile(`(?i)("[a-z_]*(?:token|password|secret)"\s*:\s*")[^"]*(")`)
+	secretCookieRegexp = regexp.MustCompile(`((?:__Secure-|__Host-)[A-Za-z0-9._-]+|cf_clearance|__cf_bm|_puid)=[^;\s"]+`)
+	emailAddressRegexp = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// isNoop returns true if the current LogRedaction does not redact anything
+func (r LogRedaction) isNoop() bool {
+	return r.KeepSecrets && r.KeepEmails && !r.RedactContent
+}
+
+// wrapCore returns a zap.Option wrapping the core of a zap.Logger with the current LogRedaction
+func (r LogRedaction) wrapCore() zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &redactingCore{Core: core, policy: r}
+	})
+}
+
+// redactString masks the secrets and the email addresses found in the given string depending on the current
+// LogRedaction
+func (r LogRedaction) redactString(s string) string {
+	if !r.KeepSecrets {
+		s = bearerTokenRegexp.ReplaceAllString(s, "${1}"+redactedValue)
+		s = jwtRegexp.ReplaceAllString(s, redactedValue)
+		s = secretJSONRegexp.ReplaceAllString(s, "${1}"+redactedValue+"${2}")
+		s = secretCookieRegexp.ReplaceAllString(s, "${1}="+redactedValue)
+	}
+	if !r.KeepEmails {
+		s = emailAddressRegexp.ReplaceAllString(s, redactedValue)
+	}
+	return s
+}
+
+// isSecretField returns true if the field identified by the given key contains a secret
+func isSecretField(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range secretFieldKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactField returns the given zapcore.Field with its value redacted depending on the current LogRedaction
+func (r LogRedaction) redactField(field zapcore.Field) zapcore.Field {
+	if r.isRedactedKey(field.Key) {
+		return zap.String(field.Key, redactedValue)
+	}
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = r.redactString(field.String)
+	case zapcore.ByteStringType:
+		return zap.String(field.Key, r.redactString(string(field.Interface.([]byte))))
+	case zapcore.StringerType:
+		return zap.String(field.Key, r.redactString(field.Interface.(fmt.Stringer).String()))
+	case zapcore.ErrorType:
+		return zap.String(field.Key, r.redactString(field.Interface.(error).Error()))
+	case zapcore.ReflectType:
+		return zap.Any(field.Key, r.redactReflected(field.Interface))
+	case zapcore.ArrayMarshalerType:
+		return zap.Array(field.Key, redactingArrayMarshaler{marshaler: field.Interface.(zapcore.ArrayMarshaler), policy: r})
+	case zapcore.ObjectMarshalerType:
+		return zap.Object(field.Key, redactingObjectMarshaler{marshaler: field.Interface.(zapcore.ObjectMarshaler), policy: r})
+	case zapcore.InlineMarshalerType:
+		return zap.Inline(redactingObjectMarshaler{marshaler: field.Interface.(zapcore.ObjectMarshaler), policy: r})
+	}
+	return field
+}
+
+// redactReflected returns the given value redacted depending on the current LogRedaction, by redacting its JSON
+// encoding. It returns redactedValue if the value can not be encoded
+func (r LogRedaction) redactReflected(value interface{}) interface{} {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return redactedValue
+	}
+	var redacted interface{}
+	if err := json.Unmarshal([]byte(r.redactString(string(encoded))), &redacted); err != nil {
+		return redactedValue
+	}
+	return redacted
+}
+
+// isRedactedKey returns true if the whole value identified by the given key should be redacted depending on the
+// current LogRedaction
+func (r LogRedaction) isRedactedKey(key string) bool {
+	return (!r.KeepSecrets && isSecretField(key)) || (r.RedactContent && contentFieldKeys[key])
+}
+
+// redactFields returns a copy of the given fields redacted depending on the current LogRedaction
+func (r LogRedaction) redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = r.redactField(field)
+	}
+	return redacted
+}
+
+// redactingCore is a zapcore.Core redacting the messages and the fields of the entries before writing them
+type redactingCore struct {
+	zapcore.Core
+	policy LogRedaction
+}
+
+// With returns a new redactingCore including the given fields once redacted
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.policy.redactFields(fields)), policy: c.policy}
+}
+
+// Check adds the current redactingCore to the given zapcore.CheckedEntry if the level of the entry is enabled
+func (c *redactingCore) Check(entry zapcore.Entry, checkedEntry *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checkedEntry.AddCore(entry, c)
+	}
+	return checkedEntry
+}
+
+// Write redacts the given zapcore.Entry and its fields and writes them using the wrapped zapcore.Core
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.policy.redactString(entry.Message)
+	return c.Core.Write(entry, c.policy.redactFields(fields))
+}
+
+// redactingArrayMarshaler is a zapcore.ArrayMarshaler redacting the elements of the wrapped zapcore.ArrayMarshaler
+type redactingArrayMarshaler struct {
+	marshaler zapcore.ArrayMarshaler
+	policy    LogRedaction
+}
+
+// MarshalLogArray marshals the wrapped zapcore.ArrayMarshaler with a redactingArrayEncoder
+func (m redactingArrayMarshaler) MarshalLogArray(encoder zapcore.ArrayEncoder) error {
+	return m.marshaler.MarshalLogArray(redactingArrayEncoder{ArrayEncoder: encoder, policy: m.policy})
+}
+
+// redactingObjectMarshaler is a zapcore.ObjectMarshaler redacting the fields of the wrapped zapcore.ObjectMarshaler
+type redactingObjectMarshaler struct {
+	marshaler zapcore.ObjectMarshaler
+	policy    LogRedaction
+}
+
+// MarshalLogObject marshals the wrapped zapcore.ObjectMarshaler with a redactingObjectEncoder
+func (m redactingObjectMarshaler) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	return m.marshaler.MarshalLogObject(redactingObjectEncoder{ObjectEncoder: encoder, policy: m.policy})
+}
+
+// redactingArrayEncoder is a zapcore.ArrayEncoder redacting the strings, the reflected values and the nested arrays
+// and objects before appending them
+type redactingArrayEncoder struct {
+	zapcore.ArrayEncoder
+	policy LogRedaction
+}
+
+// AppendString appends the given string once redacted
+func (e redactingArrayEncoder) AppendString(value string) {
+	e.ArrayEncoder.AppendString(e.policy.redactString(value))
+}
+
+// AppendByteString appends the given UTF-8 encoded bytes once redacted
+func (e redactingArrayEncoder) AppendByteString(value []byte) {
+	e.ArrayEncoder.AppendString(e.policy.redactString(string(value)))
+}
+
+// AppendArray appends the given zapcore.ArrayMarshaler once redacted
+func (e redactingArrayEncoder) AppendArray(value zapcore.ArrayMarshaler) error {
+	return e.ArrayEncoder.AppendArray(redactingArrayMarshaler{marshaler: value, policy: e.policy})
+}
+
+// AppendObject appends the given zapcore.ObjectMarshaler once redacted
+func (e redactingArrayEncoder) AppendObject(value zapcore.ObjectMarshaler) error {
+	return e.ArrayEncoder.AppendObject(redactingObjectMarshaler{marshaler: value, policy: e.policy})
+}
+
+// AppendReflected appends the given value once redacted
+func (e redactingArrayEncoder) AppendReflected(value interface{}) error {
+	return e.ArrayEncoder.AppendReflected(e.policy.redactReflected(value))
+}
+
+// redactingObjectEncoder is a zapcore.ObjectEncoder redacting the strings, the reflected values, the nested arrays and
+// objects, and the values of the secret and content keys before adding them
+type redactingObjectEncoder struct {
+	zapcore.ObjectEncoder
+	policy LogRedaction
+}
+
+// AddString adds the given string once redacted
+func (e redactingObjectEncoder) AddString(key, value string) {
+	if e.policy.isRedactedKey(key) {
+		value = redactedValue
+	}
+	e.ObjectEncoder.AddString(key, e.policy.redactString(value))
+}
+
+// AddByteString adds the given UTF-8 encoded bytes once redacted
+func (e redactingObjectEncoder) AddByteString(key string, value []byte) {
+	e.AddString(key, string(value))
+}
+
+// AddBinary adds the given bytes, or redactedValue if the key is redacted
+func (e redactingObjectEncoder) AddBinary(key string, value []byte) {
+	if e.policy.isRedactedKey(key) {
+		e.ObjectEncoder.AddString(key, redactedValue)
+		return
+	}
+	e.ObjectEncoder.AddBinary(key, value)
+}
+
+// AddArray adds the given zapcore.ArrayMarshaler once redacted
+func (e redactingObjectEncoder) AddArray(key string, value zapcore.ArrayMarshaler) error {
+	if e.policy.isRedactedKey(key) {
+		e.ObjectEncoder.AddString(key, redactedValue)
+		return nil
+	}
+	return e.ObjectEncoder.AddArray(key, redactingArrayMarshaler{marshaler: value, policy: e.policy})
+}
+
+// AddObject adds the given zapcore.ObjectMarshaler once redacted
+func (e redactingObjectEncoder) AddObject(key string, value zapcore.ObjectMarshaler) error {
+	if e.policy.isRedactedKey(key) {
+		e.ObjectEncoder.AddString(key, redactedValue)
+		return nil
+	}
+	return e.ObjectEncoder.AddObject(key, redactingObjectMarshaler{marshaler: value, policy: e.policy})
+}
+
+// AddReflected adds the given value once redacted
+func (e redactingObjectEncoder) AddReflected(key string, value interface{}) error {
+	if e.policy.isRedactedKey(key) {
+		e.ObjectEncoder.AddString(key, redactedValue)
+		return nil
+	}
+	return e.ObjectEncoder.AddReflected(key, e.policy.redactReflected(value))
+}
@@ -0,0 +1,157 @@
+package gogpt
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"reflect"
+	"testing"
+)
+
+func TestRedactString(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy LogRedaction
+		value  string
+		want   string
+	}{
+		{
+			name:  "bearer header",
+			value: "Authorization: Bearer abc.def-ghi_jkl",
+			want:  "Authorization: Bearer [REDACTED]",
+		},
+		{
+			name:  "bare JWT",
+			value: "access token eyJhbGciOiJIUzI1NiJ9.eyJleHAiOjF9.c2lnbmF0dXJl expired",
+			want:  "access token [REDACTED] expired",
+		},
+		{
+			name:  "JSON secret fields",
+			value: `{"accessToken":"abc","password" : "p@ss","sessionToken":"def","name":"gogpt"}`,
+			want:  `{"accessToken":"[REDACTED]","password" : "[REDACTED]","sessionToken":"[REDACTED]","name":"gogpt"}`,
+		},
+		{
+			name:  "cookie header",
+			value: "Cookie: __Secure-next-auth.session-token=abc; cf_clearance=def; _puid=ghi; theme=dark",
+			want:  "Cookie: __Secure-next-auth.session-token=[REDACTED]; cf_clearance=[REDACTED]; _puid=[REDACTED]; theme=dark",
+		},
+		{
+			name:  "set-cookie header",
+			value: "Set-Cookie: __Host-next-auth.csrf-token=abc%7Cdef; Path=/; Secure; HttpOnly",
+			want:  "Set-Cookie: __Host-next-auth.csrf-token=[REDACTED]; Path=/; Secure; HttpOnly",
+		},
+		{
+			name:  "email address",
+			value: "logged in as first.last+gogpt@example.co.uk",
+			want:  "logged in as [REDACTED]",
+		},
+		{
+			name:   "kept secrets",
+			policy: LogRedaction{KeepSecrets: true},
+			value:  "Bearer abc sent by user@example.com",
+			want:   "Bearer abc sent by [REDACTED]",
+		},
+		{
+			name:   "kept emails",
+			policy: LogRedaction{KeepEmails: true},
+			value:  "Bearer abc sent by user@example.com",
+			want:   "Bearer [REDACTED] sent by user@example.com",
+		},
+		{
+			name:  "nothing to redact",
+			value: "Conversation created",
+			want:  "Conversation created",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.redactString(test.value); got != test.want {
+				t.Errorf("redactString(%q) = %q, want %q", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+// observeRedactedLogs returns a zap.Logger redacting its entries with the given LogRedaction, and the logs it writes
+func observeRedactedLogs(policy LogRedaction) (*zap.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return zap.New(core, policy.wrapCore()), logs
+}
+
+func TestRedactingCoreRedactsTheFields(t *testing.T) {
+	logger, logs := observeRedactedLogs(LogRedaction{})
+	logger.With(zap.String("session-token", "abc")).Error("Request of user@example.com failed",
+		zap.String("access-token", "def"),
+		zap.Error(errors.New("unauthorized: Bearer ghi")),
+		zap.ByteString("body", []byte(`{"accessToken":"jkl","detail":"expired"}`)),
+		zap.String("request-body", "hello"),
+		zap.Any("session", map[string]string{"accessToken": "mno", "email": "user@example.com"}),
+	)
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("%d entries logged, want 1", len(entries))
+	}
+	if entries[0].Message != "Request of [REDACTED] failed" {
+		t.Errorf("message = %q, want the email address redacted", entries[0].Message)
+	}
+	want := map[string]interface{}{
+		"session-token": redactedValue,
+		"access-token":  redactedValue,
+		"error":         "unauthorized: Bearer [REDACTED]",
+		"body":          `{"accessToken":"[REDACTED]","detail":"expired"}`,
+		"request-body":  "hello",
+		"session":       map[string]interface{}{"accessToken": redactedValue, "email": redactedValue},
+	}
+	if got := entries[0].ContextMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+}
+
+func TestRedactingCoreRedactsTheArraysAndTheObjects(t *testing.T) {
+	logger, logs := observeRedactedLogs(LogRedaction{})
+	logger.Info("Accounts",
+		zap.Strings("emails", []string{"first@example.com", "second@example.com"}),
+		zap.Object("account", zapcore.ObjectMarshalerFunc(func(encoder zapcore.ObjectEncoder) error {
+			encoder.AddString("email", "user@example.com")
+			encoder.AddString("password", "secret")
+			encoder.AddInt("conversations", 2)
+			return encoder.AddArray("headers", zapcore.ArrayMarshalerFunc(func(encoder zapcore.ArrayEncoder) error {
+				encoder.AppendString("Authorization: Bearer abc")
+				return nil
+			}))
+		})),
+	)
+
+	want := map[string]interface{}{
+		"emails": []interface{}{redactedValue, redactedValue},
+		"account": map[string]interface{}{
+			"email":         redactedValue,
+			"password":      redactedValue,
+			"conversations": 2,
+			"headers":       []interface{}{"Authorization: Bearer [REDACTED]"},
+		},
+	}
+	if got := logs.All()[0].ContextMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+}
+
+func TestRedactContent(t *testing.T) {
+	logger, logs := observeRedactedLogs(LogRedaction{RedactContent: true})
+	logger.Debug("Message sent", zap.String("request-body", "hello"), zap.String("message-text", "world"),
+		zap.String("conversation-id", "conversation"))
+
+	want := map[string]interface{}{
+		"request-body":    redactedValue,
+		"message-text":    redactedValue,
+		"conversation-id": "conversation",
+	}
+	if got := logs.All()[0].ContextMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+	if !(LogRedaction{KeepSecrets: true, KeepEmails: true}).isNoop() || (LogRedaction{KeepSecrets: true, KeepEmails: true, RedactContent: true}).isNoop() {
+		t.Error("isNoop does not take RedactContent into account")
+	}
+}
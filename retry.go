@@ -0,0 +1,163 @@
+package gogpt
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff     = 30 * time.Second
+	defaultRetryMultiplier     = 2
+	defaultRetryJitter         = 0.2
+)
+
+// RetryPolicy defines how the idempotent requests are retried after a transient failure, such as a connection reset,
+// a timeout, a rate limit or a server error. Its zero value uses the default values of each field
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a request, including the first one. It defaults to 3. Set it
+	// to 1 to disable the retries
+	MaxAttempts uint
+	// InitialBackoff is the delay before the first retry. It defaults to 500ms
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts, including the delay requested by a Retry-After header.
+	// It defaults to 30s
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the delay after each retry. It defaults to 2
+	Multiplier float64
+	// Jitter is the fraction of the delay which is randomised to spread the retries. It defaults to 0.2. Use a
+	// negative value to disable it
+	Jitter float64
+}
+
+// resolve returns a copy of the current RetryPolicy with the default values set for the fields which are not set
+func (p RetryPolicy) resolve() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultRetryMultiplier
+	}
+	if p.Jitter == 0 {
+		p.Jitter = defaultRetryJitter
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	return p
+}
+
+// backoff returns the delay to wait before the given retry, starting from 0. If the given error is an APIError with
+// a Retry-After delay, this delay is used instead of the exponential backoff. The returned delay is never greater
+// than MaxBackoff
+func (p RetryPolicy) backoff(retry uint, err error) time.Duration {
+	var apiError *APIError
+	if errors.As(err, &apiError) && apiError.RetryAfter > 0 {
+		if apiError.RetryAfter > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+		return apiError.RetryAfter
+	}
+	delay := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry))
+	delay = math.Min(delay, float64(p.MaxBackoff))
+	// Randomise the delay between (1 - Jitter) * delay and delay
+	delay -= delay * p.Jitter * rand.Float64()
+	return time.Duration(delay)
+}
+
+// isIdempotentRequest returns true if a request sent with the given method can be safely sent again. The PATCH
+// requests are considered as idempotent as they only set absolute values on the conversations and the shared links
+func isIdempotentRequest(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodPatch:
+		return true
+	}
+	return false
+}
+
+// isRetryableError returns true if the given error is a transient failure for which the request can be retried
+// with the given context.Context
+func isRetryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiError *APIError
+	if errors.As(err, &apiError) {
+		return apiError.Retryable()
+	}
+	// The http.Client returns a url.Error, which is also a net.Error, for any failure such as an invalid certificate or
+	// an unsupported scheme, so only its underlying error is checked
+	var urlError *url.Error
+	if errors.As(err, &urlError) {
+		err = urlError.Err
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
+
+// parseRetryAfter returns the delay requested by the given value of a Retry-After header, either in seconds or as an
+// HTTP date. It returns 0 if the value is empty or invalid
+func parseRetryAfter(value string) time.Duration {
+	if isEmpty(value) {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// retry calls the given function until it succeeds, following the retry policy of the current gpt instance. The
+// function is only called once if the request sent with the given method on the given endpoint is not idempotent
+func (g *gpt) retry(ctx context.Context, method, endpoint string, request func() error) error {
+	if !isIdempotentRequest(method) {
+		return request()
+	}
+	var err error
+	for attempt := uint(0); attempt < g.retryPolicy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := g.retryPolicy.backoff(attempt-1, err)
+			g.logger.Debug("Retrying the request after a transient failure", zap.String("endpoint", endpoint),
+				zap.String("method", method), zap.Uint("attempt", attempt), zap.Duration("delay", delay), zap.Error(err))
+			if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+				return sleepErr
+			}
+		}
+		err = request()
+		if err == nil || !isRetryableError(ctx, err) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package gogpt
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error which is a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableError(t *testing.T) {
+	urlError := func(err error) error {
+		return &url.Error{Op: http.MethodGet, URL: "https://chat.openai.com/backend-api/models", Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", &APIError{StatusCode: http.StatusBadGateway}, true},
+		{"client error", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"connection reset", urlError(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{"timeout", urlError(timeoutError{}), true},
+		{"unexpected EOF", fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), true},
+		{"unknown certificate authority", urlError(x509.UnknownAuthorityError{}), false},
+		{"unsupported scheme", urlError(errors.New(`unsupported protocol scheme "ftp"`)), false},
+		{"connection refused", urlError(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), false},
+		{"other error", errors.New("error"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isRetryableError(context.Background(), test.err); got != test.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryableErrorWithDoneContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if isRetryableError(ctx, &APIError{StatusCode: http.StatusBadGateway}) {
+		t.Error("an error is retryable after the cancellation of the context")
+	}
+}
+
+func TestBackoffHonoursRetryAfter(t *testing.T) {
+	policy := RetryPolicy{Jitter: -1}.resolve()
+	if got := policy.backoff(0, nil); got != defaultRetryInitialBackoff {
+		t.Errorf("first backoff = %s, want %s", got, defaultRetryInitialBackoff)
+	}
+	if got := policy.backoff(1, nil); got != 2*defaultRetryInitialBackoff {
+		t.Errorf("second backoff = %s, want %s", got, 2*defaultRetryInitialBackoff)
+	}
+	if got := policy.backoff(0, &APIError{RetryAfter: 2 * time.Second}); got != 2*time.Second {
+		t.Errorf("backoff with Retry-After = %s, want 2s", got)
+	}
+	if got := policy.backoff(0, &APIError{RetryAfter: time.Hour}); got != defaultRetryMaxBackoff {
+		t.Errorf("backoff with a long Retry-After = %s, want %s", got, defaultRetryMaxBackoff)
+	}
+}
@@ -2,11 +2,21 @@ package gogpt
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 )
 
 const sessionExpirationTimeLayout = "2006-01-02T15:04:05.999Z"
 
+// sessionExpirationTimeLayouts are the layouts accepted for the Expires attribute of a Session
+var sessionExpirationTimeLayouts = []string{
+	time.RFC3339Nano,
+	sessionExpirationTimeLayout,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
 type User struct {
 	ID      string   `json:"id"`
 	Name    string   `json:"name"`
@@ -33,12 +43,59 @@ func unmarshalGPTSessionResponseJSON(jsonData []byte) (*Session, error) {
 	return &result, nil
 }
 
-// isExpired function verifies if the current session is expired by using its Expires attribute
-// if returns an error if the Expires string can not be passed using sessionExpirationTimeLayout
-func (s *Session) isExpired() (bool, error) {
-	expirationTime, err := time.Parse(sessionExpirationTimeLayout, s.Expires)
+// parseSessionExpirationTime parses the given Expires attribute of a Session. It accepts the RFC3339 times with or
+// without fractional seconds, and the times without time zone which are considered as UTC
+func parseSessionExpirationTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	var err error
+	for _, layout := range sessionExpirationTimeLayouts {
+		var expirationTime time.Time
+		expirationTime, err = time.Parse(layout, value)
+		if err == nil {
+			return expirationTime, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// expiresAt returns the expiration time of the current session, which is the earliest time between its Expires
+// attribute and the expiration time of its access token if it is a JWT. It returns a zero time.Time if the session
+// has no expiration time, and an error if the Expires attribute can not be parsed
+func (s *Session) expiresAt() (time.Time, error) {
+	expirationTime, err := accessTokenExpiry(s.AccessToken)
+	if err != nil {
+		expirationTime = time.Time{}
+	}
+	if isEmpty(s.Expires) {
+		return expirationTime, nil
+	}
+	sessionExpirationTime, err := parseSessionExpirationTime(s.Expires)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if expirationTime.IsZero() || sessionExpirationTime.Before(expirationTime) {
+		return sessionExpirationTime, nil
+	}
+	return expirationTime, nil
+}
+
+// isExpired function verifies if the current session is expired, or expires in less than the given margin, by using
+// its Expires attribute and the expiration time of its access token if it is a JWT. A session without expiration time
+// is not expired, see SessionRefreshPolicy for its refresh.
+// if returns an error if the Expires string can not be parsed
+func (s *Session) isExpired(margin time.Duration) (bool, error) {
+	expirationTime, err := s.expiresAt()
 	if err != nil {
 		return true, err
 	}
-	return expirationTime.Before(time.Now()), nil
+	if expirationTime.IsZero() {
+		return false, nil
+	}
+	return !time.Now().Add(margin).Before(expirationTime), nil
+}
+
+// hasExpirationTime returns true if the expiration time of the current session is known
+func (s *Session) hasExpirationTime() bool {
+	expirationTime, err := s.expiresAt()
+	return err == nil && !expirationTime.IsZero()
 }
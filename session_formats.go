@@ -0,0 +1,327 @@
+package gogpt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/playwright-community/playwright-go"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// netscapeHttpOnlyPrefix is the prefix of the lines of the cookies with the HttpOnly attribute in a Netscape cookies.txt
+// file, as written by curl and the browser extensions
+const netscapeHttpOnlyPrefix = "#HttpOnly_"
+
+// ErrNotLoggedIn is returned when an operation needs a session but the GoGPT instance is not logged in
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// SessionBundle is a logged-in session of a ChatGPT account, made of its access token and its cookies. It is encoded
+// in JSON as {"accessToken": "...", "cookies": [...]}
+type SessionBundle struct {
+	// AccessToken is the access token used in the authorization header of the requests. It may be empty
+	AccessToken string
+	// Cookies are the cookies of the session, including the session token cookie
+	Cookies []*http.Cookie
+}
+
+// sessionBundleJSON is the JSON representation of a SessionBundle
+type sessionBundleJSON struct {
+	AccessToken string                `json:"accessToken"`
+	Cookies     []sessionBundleCookie `json:"cookies"`
+}
+
+// sessionBundleCookie is the JSON representation of a cookie of a SessionBundle. Expires is a Unix time in seconds, or
+// 0 for a session cookie
+type sessionBundleCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Expires  int64  `json:"expires,omitempty"`
+	HttpOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	SameSite string `json:"sameSite,omitempty"`
+}
+
+// MarshalJSON encodes the current SessionBundle as {"accessToken": "...", "cookies": [...]}
+func (b SessionBundle) MarshalJSON() ([]byte, error) {
+	bundle := sessionBundleJSON{
+		AccessToken: b.AccessToken,
+		Cookies:     make([]sessionBundleCookie, 0, len(b.Cookies)),
+	}
+	for _, cookie := range b.Cookies {
+		c := sessionBundleCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookieExpires(cookie),
+			HttpOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		}
+		if sameSite := httpSameSiteToPlaywrightSameSiteAttribute(cookie.SameSite); sameSite != nil {
+			c.SameSite = string(*sameSite)
+		}
+		bundle.Cookies = append(bundle.Cookies, c)
+	}
+	return json.Marshal(bundle)
+}
+
+// UnmarshalJSON decodes a SessionBundle encoded as {"accessToken": "...", "cookies": [...]}
+func (b *SessionBundle) UnmarshalJSON(data []byte) error {
+	var bundle sessionBundleJSON
+	err := json.Unmarshal(data, &bundle)
+	if err != nil {
+		return err
+	}
+	b.AccessToken = bundle.AccessToken
+	playwrightCookies := make([]*playwright.BrowserContextCookiesResult, len(bundle.Cookies))
+	for i, c := range bundle.Cookies {
+		playwrightCookies[i] = &playwright.BrowserContextCookiesResult{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  float64(c.Expires),
+			HttpOnly: c.HttpOnly,
+			Secure:   c.Secure,
+			SameSite: playwright.SameSiteAttribute(c.SameSite),
+		}
+	}
+	b.Cookies = playwrightCookiesToHttpCookies(playwrightCookies)
+	return nil
+}
+
+// SessionToken returns the value of the session token cookie of the current SessionBundle, or an empty string if
+// there is no session token cookie
+func (b *SessionBundle) SessionToken() string {
+	for _, cookie := range b.Cookies {
+		if cookie.Name == sessionTokenCookieName {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// TokenAuthenticator returns a TokenAuthenticator using the access token and the session token of the current
+// SessionBundle, to use the session without a browser
+func (b *SessionBundle) TokenAuthenticator() *TokenAuthenticator {
+	return &TokenAuthenticator{
+		AccessToken:  b.AccessToken,
+		SessionToken: b.SessionToken(),
+	}
+}
+
+// ReadSessionBundle reads a SessionBundle encoded in JSON from the given io.Reader
+func ReadSessionBundle(r io.Reader) (*SessionBundle, error) {
+	var bundle SessionBundle
+	err := json.NewDecoder(r).Decode(&bundle)
+	if err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// WriteSessionBundle writes the given SessionBundle encoded in JSON to the given io.Writer
+func WriteSessionBundle(w io.Writer, bundle *SessionBundle) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(bundle)
+}
+
+// ReadStorageState reads the cookies of a playwright storage state, such as the file written at BrowserContextPath,
+// from the given io.Reader. The local storage of the storage state is ignored
+func ReadStorageState(r io.Reader) ([]*http.Cookie, error) {
+	var state playwright.StorageState
+	err := json.NewDecoder(r).Decode(&state)
+	if err != nil {
+		return nil, err
+	}
+	playwrightCookies := make([]*playwright.BrowserContextCookiesResult, len(state.Cookies))
+	for i, c := range state.Cookies {
+		playwrightCookies[i] = &playwright.BrowserContextCookiesResult{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			HttpOnly: c.HttpOnly,
+			Secure:   c.Secure,
+			SameSite: playwright.SameSiteAttribute(c.SameSite),
+		}
+	}
+	return playwrightCookiesToHttpCookies(playwrightCookies), nil
+}
+
+// WriteStorageState writes the given cookies as a playwright storage state to the given io.Writer. The written storage
+// state can be used as BrowserContextPath, or saved in a CredentialStore with the CredentialKeyStorageState key
+func WriteStorageState(w io.Writer, cookies []*http.Cookie) error {
+	state := playwright.StorageState{
+		Cookies: make([]playwright.Cookie, 0, len(cookies)),
+		Origins: []playwright.OriginsState{},
+	}
+	for _, cookie := range cookies {
+		c := playwright.Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  -1,
+			HttpOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+			// Playwright uses Lax when the SameSite attribute is not set
+			SameSite: string(*playwright.SameSiteAttributeLax),
+		}
+		if expires := cookieExpires(cookie); expires > 0 {
+			c.Expires = float64(expires)
+		}
+		if isEmpty(c.Path) {
+			c.Path = "/"
+		}
+		if sameSite := httpSameSiteToPlaywrightSameSiteAttribute(cookie.SameSite); sameSite != nil {
+			c.SameSite = string(*sameSite)
+		}
+		state.Cookies = append(state.Cookies, c)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(state)
+}
+
+// ReadNetscapeCookies reads the cookies of a Netscape cookies.txt file, as written by curl or the browser extensions,
+// from the given io.Reader. It returns an error if a line is malformed
+func ReadNetscapeCookies(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, netscapeHttpOnlyPrefix)
+		if httpOnly {
+			line = strings.TrimPrefix(line, netscapeHttpOnlyPrefix)
+		}
+		if isEmpty(strings.TrimSpace(line)) || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d of the cookies file should have 7 fields separated by tabs, got %d", lineNumber, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiration time on line %d of the cookies file: %w", lineNumber, err)
+		}
+		cookie := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, cookie)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cookies, nil
+}
+
+// WriteNetscapeCookies writes the given cookies in the Netscape cookies.txt format to the given io.Writer. The written
+// file can be used with the --cookie option of curl
+func WriteNetscapeCookies(w io.Writer, cookies []*http.Cookie) error {
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString("# Netscape HTTP Cookie File\n")
+	if err != nil {
+		return err
+	}
+	for _, cookie := range cookies {
+		domain := cookie.Domain
+		if cookie.HttpOnly {
+			domain = netscapeHttpOnlyPrefix + domain
+		}
+		path := cookie.Path
+		if isEmpty(path) {
+			path = "/"
+		}
+		_, err = fmt.Fprintf(
+			bw,
+			"%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain,
+			netscapeBool(strings.HasPrefix(cookie.Domain, ".")),
+			path,
+			netscapeBool(cookie.Secure),
+			cookieExpires(cookie),
+			cookie.Name,
+			cookie.Value,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// netscapeBool returns the representation of the given bool value in a Netscape cookies.txt file
+func netscapeBool(value bool) string {
+	if value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// cookieExpires returns the expiration time of the given *http.Cookie as a Unix time in seconds, or 0 if it is a
+// session cookie
+func cookieExpires(cookie *http.Cookie) int64 {
+	if cookie.Expires.IsZero() || cookie.Expires.Unix() <= 0 {
+		return 0
+	}
+	return cookie.Expires.Unix()
+}
+
+// ExportSession returns the access token and the cookies of the current session, to use them with curl, with a
+// TokenAuthenticator or in another browser context
+func (g *gpt) ExportSession() (*SessionBundle, error) {
+	return g.ExportSessionContext(context.Background())
+}
+
+// ExportSessionContext returns the access token and the cookies of the current session using the given
+// context.Context. It returns ErrNotLoggedIn if the current gpt instance is not logged in
+func (g *gpt) ExportSessionContext(ctx context.Context) (*SessionBundle, error) {
+	s := g.currentSession()
+	if s == nil {
+		return nil, ErrNotLoggedIn
+	}
+	cookies, err := g.authenticator.Cookies(ctx, g.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(g.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &SessionBundle{
+		AccessToken: s.AccessToken,
+		Cookies:     make([]*http.Cookie, len(cookies)),
+	}
+	for i, cookie := range cookies {
+		c := *cookie
+		// The cookies of a TokenAuthenticator have no domain, which is required by the other formats
+		if isEmpty(c.Domain) {
+			c.Domain = u.Hostname()
+		}
+		bundle.Cookies[i] = &c
+	}
+	return bundle, nil
+}
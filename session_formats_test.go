@@ -0,0 +1,209 @@
+package gogpt_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/Makepad-fr/gogpt"
+	"github.com/Makepad-fr/gogpt/gogpttest"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCookies returns a persistent HttpOnly session token cookie and a session cookie of a parent domain
+func testCookies() []*http.Cookie {
+	return []*http.Cookie{
+		{
+			Name:     "__Secure-next-auth.session-token",
+			Value:    "session-token",
+			Domain:   "chat.openai.com",
+			Path:     "/",
+			Expires:  time.Unix(1900000000, 0),
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		{
+			Name:     "cf_clearance",
+			Value:    "clearance",
+			Domain:   ".openai.com",
+			Path:     "/",
+			SameSite: http.SameSiteNoneMode,
+		},
+	}
+}
+
+// assertSameCookies verifies that the given cookies have the same attributes, excepted SameSite if checkSameSite is
+// false
+func assertSameCookies(t *testing.T, got, want []*http.Cookie, checkSameSite bool) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d cookies, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Name != w.Name || g.Value != w.Value || g.Domain != w.Domain || g.Path != w.Path ||
+			g.Secure != w.Secure || g.HttpOnly != w.HttpOnly || !g.Expires.Equal(w.Expires) ||
+			(checkSameSite && g.SameSite != w.SameSite) {
+			t.Errorf("cookie %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestNetscapeCookiesRoundTrip(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := gogpt.WriteNetscapeCookies(&buffer, testCookies()); err != nil {
+		t.Fatalf("WriteNetscapeCookies returned an error: %v", err)
+	}
+	want := "# Netscape HTTP Cookie File\n" +
+		"#HttpOnly_chat.openai.com\tFALSE\t/\tTRUE\t1900000000\t__Secure-next-auth.session-token\tsession-token\n" +
+		".openai.com\tTRUE\t/\tFALSE\t0\tcf_clearance\tclearance\n"
+	if buffer.String() != want {
+		t.Errorf("written cookies file = %q, want %q", buffer.String(), want)
+	}
+
+	cookies, err := gogpt.ReadNetscapeCookies(&buffer)
+	if err != nil {
+		t.Fatalf("ReadNetscapeCookies returned an error: %v", err)
+	}
+	// The cookies.txt format has no SameSite attribute
+	assertSameCookies(t, cookies, testCookies(), false)
+}
+
+func TestReadNetscapeCookiesWithCRLFLineEndings(t *testing.T) {
+	content := "# Netscape HTTP Cookie File\r\n" +
+		"# https://curl.se/docs/http-cookies.html\r\n" +
+		"\r\n" +
+		"#HttpOnly_chat.openai.com\tFALSE\t/\tTRUE\t1900000000\t__Secure-next-auth.session-token\tsession-token\r\n" +
+		".openai.com\tTRUE\t/\tFALSE\t0\tcf_clearance\tclearance\r\n"
+	cookies, err := gogpt.ReadNetscapeCookies(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ReadNetscapeCookies returned an error: %v", err)
+	}
+	assertSameCookies(t, cookies, testCookies(), false)
+}
+
+func TestReadNetscapeCookiesRejectsMalformedLines(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"missing field", "chat.openai.com\tFALSE\t/\tTRUE\t0\tname"},
+		{"extra field", "chat.openai.com\tFALSE\t/\tTRUE\t0\tname\tvalue\textra"},
+		{"spaces instead of tabs", "chat.openai.com FALSE / TRUE 0 name value"},
+		{"bad expiration time", "chat.openai.com\tFALSE\t/\tTRUE\tsoon\tname\tvalue"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := "# Netscape HTTP Cookie File\n" + test.line + "\n"
+			_, err := gogpt.ReadNetscapeCookies(strings.NewReader(content))
+			if err == nil || !strings.Contains(err.Error(), "line 2") {
+				t.Errorf("ReadNetscapeCookies returned %v, want an error on line 2", err)
+			}
+		})
+	}
+}
+
+func TestStorageStateRoundTrip(t *testing.T) {
+	cookies := testCookies()
+	// A cookie without path nor SameSite attribute gets the defaults of playwright
+	cookies = append(cookies, &http.Cookie{Name: "_puid", Value: "puid", Domain: "chat.openai.com"})
+	var buffer bytes.Buffer
+	if err := gogpt.WriteStorageState(&buffer, cookies); err != nil {
+		t.Fatalf("WriteStorageState returned an error: %v", err)
+	}
+
+	var state struct {
+		Cookies []struct {
+			Name     string  `json:"name"`
+			Path     string  `json:"path"`
+			Expires  float64 `json:"expires"`
+			SameSite string  `json:"sameSite"`
+		} `json:"cookies"`
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &state); err != nil {
+		t.Fatal(err)
+	}
+	if got := state.Cookies[1]; got.Expires != -1 || got.SameSite != "None" {
+		t.Errorf("written session cookie = %+v, want expires -1 and SameSite None", got)
+	}
+	if got := state.Cookies[2]; got.Path != "/" || got.SameSite != "Lax" {
+		t.Errorf("written cookie without attributes = %+v, want the path / and SameSite Lax", got)
+	}
+
+	read, err := gogpt.ReadStorageState(&buffer)
+	if err != nil {
+		t.Fatalf("ReadStorageState returned an error: %v", err)
+	}
+	cookies[2].Path = "/"
+	cookies[2].SameSite = http.SameSiteLaxMode
+	assertSameCookies(t, read, cookies, true)
+}
+
+func TestSessionBundleJSON(t *testing.T) {
+	bundle := &gogpt.SessionBundle{AccessToken: "access-token", Cookies: testCookies()}
+	var buffer bytes.Buffer
+	if err := gogpt.WriteSessionBundle(&buffer, bundle); err != nil {
+		t.Fatalf("WriteSessionBundle returned an error: %v", err)
+	}
+
+	var encoded struct {
+		AccessToken string                   `json:"accessToken"`
+		Cookies     []map[string]interface{} `json:"cookies"`
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &encoded); err != nil {
+		t.Fatal(err)
+	}
+	if encoded.AccessToken != "access-token" || len(encoded.Cookies) != 2 {
+		t.Fatalf("encoded bundle = %+v, want the access token and 2 cookies", encoded)
+	}
+	if encoded.Cookies[0]["expires"] != float64(1900000000) || encoded.Cookies[0]["sameSite"] != "Lax" {
+		t.Errorf("encoded cookie = %v, want its expiration time and SameSite", encoded.Cookies[0])
+	}
+	if _, ok := encoded.Cookies[1]["expires"]; ok {
+		t.Errorf("encoded session cookie = %v, want no expiration time", encoded.Cookies[1])
+	}
+
+	read, err := gogpt.ReadSessionBundle(&buffer)
+	if err != nil {
+		t.Fatalf("ReadSessionBundle returned an error: %v", err)
+	}
+	if read.AccessToken != "access-token" {
+		t.Errorf("access token = %q, want %q", read.AccessToken, "access-token")
+	}
+	assertSameCookies(t, read.Cookies, testCookies(), true)
+	authenticator := read.TokenAuthenticator()
+	if authenticator.AccessToken != "access-token" || authenticator.SessionToken != "session-token" {
+		t.Errorf("TokenAuthenticator = %+v, want the access token and the session token", authenticator)
+	}
+}
+
+func TestExportSessionFillsTheDomainOfTheCookies(t *testing.T) {
+	srv := newTestServer(t)
+	gpt, err := gogpt.New(testOptions(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpt.Close()
+	if _, err := gpt.ExportSession(); !errors.Is(err, gogpt.ErrNotLoggedIn) {
+		t.Errorf("ExportSession returned %v before the login, want ErrNotLoggedIn", err)
+	}
+	if err := gpt.Login("", ""); err != nil {
+		t.Fatalf("Login returned an error: %v", err)
+	}
+
+	bundle, err := gpt.ExportSession()
+	if err != nil {
+		t.Fatalf("ExportSession returned an error: %v", err)
+	}
+	if bundle.AccessToken != gogpttest.DefaultAccessToken || bundle.SessionToken() != gogpttest.DefaultSessionToken {
+		t.Errorf("bundle = %+v, want the access token and the session token of the server", bundle)
+	}
+	for _, cookie := range bundle.Cookies {
+		if cookie.Domain != "127.0.0.1" {
+			t.Errorf("domain of the cookie %s = %q, want the host of the BaseURL", cookie.Name, cookie.Domain)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package gogpt
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// defaultSessionRefreshMargin is the default duration before its expiration when the session is refreshed
+	defaultSessionRefreshMargin = time.Minute
+	// defaultSessionRefreshInterval is the default duration after which a session without expiration time is refreshed
+	defaultSessionRefreshInterval = 5 * time.Minute
+)
+
+// minSessionRefreshInterval is the minimum duration between two refreshes of the background session refresher. It is
+// a variable to be shortened by the tests
+var minSessionRefreshInterval = 10 * time.Second
+
+// SessionRefreshPolicy defines when the session and the cookies are refreshed before their expiration. Its zero value
+// refreshes the session one minute before its expiration, before sending a request. The expiration time of a session
+// is unknown when it has no expires field and its access token is not a JWT. Such a session is refreshed every
+// Interval, and when a request is rejected with the 401 status code
+type SessionRefreshPolicy struct {
+	// Background enables a goroutine which renews the session and the cookies Margin before the expiration of the
+	// session, so the requests and the streams do not start with a session about to expire. It is started once the
+	// session is initialised, and stopped by Close. If the session can not be renewed after the attempts of the
+	// RetryPolicy, it is stopped until the session is refreshed by a request
+	Background bool
+	// Margin is the duration before its expiration when the session is refreshed, by the background goroutine or
+	// before sending a request. It defaults to 1 minute
+	Margin time.Duration
+	// Interval is the duration after which a session without expiration time is refreshed, before sending a request.
+	// The background goroutine does not refresh such a session. It defaults to 5 minutes
+	Interval time.Duration
+}
+
+// resolve returns a copy of the current SessionRefreshPolicy with the default values set for the fields which are not
+// set
+func (p SessionRefreshPolicy) resolve() SessionRefreshPolicy {
+	if p.Margin <= 0 {
+		p.Margin = defaultSessionRefreshMargin
+	}
+	if p.Interval <= 0 {
+		p.Interval = defaultSessionRefreshInterval
+	}
+	return p
+}
+
+// setSession sets the given session as the session of the current gpt instance, if there is no error. It returns the
+// function calling the session hook related to the change, or nil if there is no hook to call.
+// OnSessionRefreshed is called when the session changes, and OnSessionLost is called once when an existing session can
+// not be refreshed, until the session is refreshed again
+func (g *gpt) setSession(ctx context.Context, s *Session, err error) func() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err != nil {
+		// A cancelled request does not mean that the session can not be refreshed
+		if ctx.Err() != nil || g.session == nil || g.sessionLost {
+			return nil
+		}
+		g.sessionLost = true
+		g.logger.Warn("The session can not be refreshed", zap.Error(err))
+		if g.onSessionLost == nil {
+			return nil
+		}
+		return func() {
+			g.onSessionLost(err)
+		}
+	}
+	previous := g.session
+	g.session = s
+	g.sessionFetchedAt = time.Now()
+	g.sessionLost = false
+	if g.onSessionRefreshed == nil ||
+		(previous != nil && previous.AccessToken == s.AccessToken && previous.Expires == s.Expires) {
+		return nil
+	}
+	session := *s
+	return func() {
+		g.onSessionRefreshed(session)
+	}
+}
+
+// renewSession renews the cookies and the session of the current gpt instance, even if they are not expired
+func (g *gpt) renewSession(ctx context.Context) error {
+	return g.loadSession(ctx, true)
+}
+
+// startSessionRefresher starts the background session refresher if it is enabled by the SessionRefreshPolicy and not
+// already running
+func (g *gpt) startSessionRefresher() {
+	if !g.sessionRefreshPolicy.Background {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed || g.sessionRefresherDone != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	g.sessionRefresherCancel = cancel
+	g.sessionRefresherDone = done
+	go func() {
+		defer close(done)
+		defer cancel()
+		g.runSessionRefresher(ctx)
+		g.mu.Lock()
+		if g.sessionRefresherDone == done {
+			g.sessionRefresherCancel = nil
+			g.sessionRefresherDone = nil
+		}
+		g.mu.Unlock()
+	}()
+}
+
+// stopSessionRefresher stops the background session refresher if it is running, waits for its end and prevents it
+// from being started again
+func (g *gpt) stopSessionRefresher() {
+	g.mu.Lock()
+	g.closed = true
+	cancel, done := g.sessionRefresherCancel, g.sessionRefresherDone
+	g.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// runSessionRefresher renews the session Margin before its expiration until the given context.Context is done. After
+// a failure, the session is renewed again following the RetryPolicy. It returns when the session has no expiration
+// time, or when it can not be renewed
+func (g *gpt) runSessionRefresher(ctx context.Context) {
+	g.logger.Debug("Session refresher started", zap.Duration("margin", g.sessionRefreshPolicy.Margin))
+	defer g.logger.Debug("Session refresher stopped")
+	var err error
+	failures := uint(0)
+	for {
+		var delay time.Duration
+		if failures > 0 {
+			delay = g.retryPolicy.backoff(failures-1, err)
+		} else {
+			session := g.currentSession()
+			if session == nil {
+				return
+			}
+			expirationTime, expirationErr := session.expiresAt()
+			if expirationErr != nil || expirationTime.IsZero() {
+				g.logger.Debug("The session has no valid expiration time", zap.String("expires", session.Expires))
+				return
+			}
+			delay = time.Until(expirationTime) - g.sessionRefreshPolicy.Margin
+			if delay < minSessionRefreshInterval {
+				delay = minSessionRefreshInterval
+			}
+		}
+		g.logger.Debug("Next session refresh scheduled", zap.Duration("delay", delay))
+		if sleepContext(ctx, delay) != nil {
+			return
+		}
+		err = g.renewSession(ctx)
+		if err == nil {
+			failures = 0
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		failures++
+		g.logger.Warn("Error while refreshing the session in the background", zap.Uint("attempt", failures), zap.Error(err))
+		if failures >= g.retryPolicy.MaxAttempts || !isRetryableError(ctx, err) {
+			return
+		}
+	}
+}
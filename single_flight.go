@@ -0,0 +1,60 @@
+package gogpt
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// singleFlight runs a function once for all the concurrent callers. The callers arriving while the function is
+// running wait for its result instead of running it again
+type singleFlight struct {
+	mu   sync.Mutex
+	call *flightCall
+}
+
+// flightCall is a running call of a singleFlight
+type flightCall struct {
+	ctx  context.Context
+	done chan struct{}
+	err  error
+}
+
+// do runs the given function if it is not already running, and returns its error. If it is already running, it waits
+// for the result of the running call or until the given context.Context is done. The given function should use the
+// given context.Context. If the running call fails because the context.Context of its caller is done, the waiting
+// callers whose context.Context is not done run the function again instead of returning this error
+func (f *singleFlight) do(ctx context.Context, fn func() error) error {
+	for {
+		f.mu.Lock()
+		if call := f.call; call != nil {
+			f.mu.Unlock()
+			select {
+			case <-call.done:
+				if call.cancelled() && ctx.Err() == nil {
+					continue
+				}
+				return call.err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		call := &flightCall{ctx: ctx, done: make(chan struct{})}
+		f.call = call
+		f.mu.Unlock()
+
+		call.err = fn()
+
+		f.mu.Lock()
+		f.call = nil
+		f.mu.Unlock()
+		close(call.done)
+		return call.err
+	}
+}
+
+// cancelled returns true if the current flightCall failed because the context.Context of its caller is done
+func (c *flightCall) cancelled() bool {
+	ctxErr := c.ctx.Err()
+	return c.err != nil && ctxErr != nil && errors.Is(c.err, ctxErr)
+}
@@ -0,0 +1,107 @@
+package gogpt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleFlightSharesTheConcurrentCalls(t *testing.T) {
+	var f singleFlight
+	var calls int32
+	release := make(chan struct{})
+	errCall := errors.New("call error")
+	fn := func() error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return errCall
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f.do(context.Background(), fn); !errors.Is(err, errCall) {
+				t.Errorf("do returned %v, want the error of the call", err)
+			}
+		}()
+	}
+	// Let the goroutines wait for the running call
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("the function is called %d times, want 1", got)
+	}
+
+	// A new call runs the function again once the previous one ended
+	_ = f.do(context.Background(), func() error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("the function is called %d times, want 2", got)
+	}
+}
+
+func TestSingleFlightWaitIsCancelledByTheContext(t *testing.T) {
+	var f singleFlight
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		_ = f.do(context.Background(), func() error {
+			<-release
+			return nil
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := f.do(ctx, func() error {
+		t.Error("the function is called while another call is running")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("do returned %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSingleFlightRunsAgainAfterTheCancellationOfTheCaller(t *testing.T) {
+	var f singleFlight
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderDone := make(chan error, 1)
+	go func() {
+		leaderDone <- f.do(leaderCtx, func() error {
+			close(started)
+			<-leaderCtx.Done()
+			return leaderCtx.Err()
+		})
+	}()
+	<-started
+
+	waiterDone := make(chan error, 1)
+	calls := int32(0)
+	go func() {
+		waiterDone <- f.do(context.Background(), func() error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancelLeader()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("do returned %v to the cancelled caller, want context.Canceled", err)
+	}
+	if err := <-waiterDone; err != nil {
+		t.Errorf("do returned %v to the waiting caller, want no error", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("the function of the waiting caller is called %d times, want 1", got)
+	}
+}
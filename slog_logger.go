@@ -0,0 +1,88 @@
+//go:build go1.21
+
+package gogpt
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"log/slog"
+	"sort"
+)
+
+// NewSlogLogger creates a zap.Logger which writes its entries to the given slog.Handler. It can be used as the Logger
+// of the Options to log through log/slog. It is only available with Go 1.21 or later, as log/slog does not exist in
+// the previous versions
+func NewSlogLogger(handler slog.Handler) *zap.Logger {
+	return zap.New(&slogCore{handler: handler})
+}
+
+// slogCore is a zapcore.Core forwarding the entries to a slog.Handler
+type slogCore struct {
+	handler slog.Handler
+}
+
+// Enabled returns true if the handler of the current slogCore handles the given zapcore.Level
+func (c *slogCore) Enabled(level zapcore.Level) bool {
+	return c.handler.Enabled(context.Background(), slogLevel(level))
+}
+
+// With returns a new slogCore whose handler includes the given fields
+func (c *slogCore) With(fields []zapcore.Field) zapcore.Core {
+	return &slogCore{handler: c.handler.WithAttrs(slogAttrs(fields))}
+}
+
+// Check adds the current slogCore to the given zapcore.CheckedEntry if the level of the entry is enabled
+func (c *slogCore) Check(entry zapcore.Entry, checkedEntry *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checkedEntry.AddCore(entry, c)
+	}
+	return checkedEntry
+}
+
+// Write converts the given zapcore.Entry and its fields to a slog.Record and passes it to the handler
+func (c *slogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	record := slog.NewRecord(entry.Time, slogLevel(entry.Level), entry.Message, 0)
+	if len(entry.LoggerName) > 0 {
+		record.AddAttrs(slog.String("logger", entry.LoggerName))
+	}
+	record.AddAttrs(slogAttrs(fields)...)
+	return c.handler.Handle(context.Background(), record)
+}
+
+// Sync does nothing as the slog.Handler does not buffer the records
+func (c *slogCore) Sync() error {
+	return nil
+}
+
+// slogLevel returns the slog.Level related to the given zapcore.Level
+func slogLevel(level zapcore.Level) slog.Level {
+	switch {
+	case level <= zapcore.DebugLevel:
+		return slog.LevelDebug
+	case level == zapcore.InfoLevel:
+		return slog.LevelInfo
+	case level == zapcore.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// slogAttrs converts the given zap fields to slog.Attr sorted by key
+func slogAttrs(fields []zapcore.Field) []slog.Attr {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+	keys := make([]string, 0, len(encoder.Fields))
+	for key := range encoder.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.Any(key, encoder.Fields[key]))
+	}
+	return attrs
+}
@@ -0,0 +1,159 @@
+package gogpt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/Makepad-fr/gogpt/internal"
+	"go.uber.org/zap"
+)
+
+type StreamEventType int
+
+const (
+	// StreamEventDelta is sent for each assistant response containing new text
+	StreamEventDelta StreamEventType = iota
+	// StreamEventMessage is sent once with the last assistant response, containing the full message
+	StreamEventMessage
+	// StreamEventError is sent when the stream is stopped because of an error
+	StreamEventError
+	// StreamEventDone is sent once the stream ended successfully
+	StreamEventDone
+)
+
+// StreamEvent is an event sent through the channel returned by the streaming variants of the conversation methods
+type StreamEvent struct {
+	Type StreamEventType
+	// Delta is the text added by the current event. Only set for StreamEventDelta
+	Delta string
+	// ReplacedRunes is the number of runes at the end of the previously received text which are replaced by Delta.
+	// Only set for StreamEventDelta
+	ReplacedRunes int
+	// Text is the cumulative text of the message. Set for StreamEventDelta and StreamEventMessage
+	Text string
+	// Response is the related ConversationResponse. Set for StreamEventDelta and StreamEventMessage
+	Response *ConversationResponse
+	// ConversationID is the id of the conversation related to the stream. Set for every event once it is known
+	ConversationID string
+	// Err is the error which stopped the stream. Only set for StreamEventError
+	Err error
+}
+
+// CreateConversationStream creates a new conversation by sending the given message and using the given model. The
+// responses are sent through the returned channel as StreamEvent, which is closed once the stream ends. Cancelling the
+// given context.Context stops the generation by closing the underlying connection. A truncated response is not
+// continued, even if AutoContinue is set.
+// The channel must be read until it is closed, or the context.Context must be cancelled: otherwise the stream blocks
+// on the next event, and the underlying connection is never closed
+func (g *gpt) CreateConversationStream(ctx context.Context, message, model string) (<-chan StreamEvent, error) {
+	if !g.isModelExists(model) {
+		return nil, fmt.Errorf("%s is not a valid model: %w", model, ErrModelNotFound)
+	}
+	messageRequest, err := createMessageRequestForNewConversation(message, model, g.timeZoneOffset)
+	if err != nil {
+		return nil, err
+	}
+	return g.streamMessageRequest(ctx, messageRequest)
+}
+
+// SendMessageStream sends the given message to the existing conversation identified by conversationID as a reply to
+// the message identified by parentMessageID, using the given model. If parentMessageID is empty, the CurrentNode of the
+// conversation is used. The responses are sent through the returned channel as StreamEvent, which is closed once the
+// stream ends. Cancelling the given context.Context stops the generation by closing the underlying connection. A
+// truncated response is not continued, even if AutoContinue is set.
+// The channel must be read until it is closed, or the context.Context must be cancelled: otherwise the stream blocks
+// on the next event, and the underlying connection is never closed
+func (g *gpt) SendMessageStream(ctx context.Context, conversationID, parentMessageID, message, model string) (<-chan StreamEvent, error) {
+	if !g.isModelExists(model) {
+		return nil, fmt.Errorf("%s is not a valid model: %w", model, ErrModelNotFound)
+	}
+	if isEmpty(parentMessageID) {
+		conversation, err := g.LoadConversationContext(ctx, conversationID)
+		if err != nil {
+			return nil, err
+		}
+		parentMessageID = conversation.CurrentNode
+	}
+	messageRequest, err := createMessageRequestInExistingConversation(message, model, conversationID, parentMessageID, g.timeZoneOffset)
+	if err != nil {
+		return nil, err
+	}
+	return g.streamMessageRequest(ctx, messageRequest)
+}
+
+// streamMessageRequest sends the given internal.NewMessageRequest and forwards the received responses to the returned
+// channel as StreamEvent. The connection is closed as soon as the given context.Context is done. Each send waits for
+// the receiver or the end of the given context.Context, as nothing else tells that the receiver stopped reading
+func (g *gpt) streamMessageRequest(ctx context.Context, messageRequest *internal.NewMessageRequest) (<-chan StreamEvent, error) {
+	resp, err := g.openConversationEventStream(ctx, messageRequest)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan StreamEvent, 1)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		streamEnded := make(chan struct{})
+		defer close(streamEnded)
+		go func() {
+			select {
+			case <-ctx.Done():
+				g.logger.Debug("Context is done, closing the event stream", zap.Error(ctx.Err()))
+				// Closing the body unblocks the reader and stops the generation
+				resp.Body.Close()
+			case <-streamEnded:
+			}
+		}()
+
+		send := func(event StreamEvent) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		var conversationId string
+		var last *ConversationResponse
+		_, err := g.handleConversationResponseEvent(ctx, bufio.NewReader(resp.Body), isEmpty(messageRequest.ConversationId), func(response ConversationResponse) error {
+			conversationId = response.ConversationID
+			last = &response
+			if len(response.Delta) == 0 && response.ReplacedRunes == 0 {
+				return nil
+			}
+			return send(StreamEvent{
+				Type:           StreamEventDelta,
+				Delta:          response.Delta,
+				ReplacedRunes:  response.ReplacedRunes,
+				Text:           response.Text,
+				Response:       &response,
+				ConversationID: conversationId,
+			})
+		})
+		if err == nil && ctx.Err() != nil {
+			// The body was closed by the cancellation which may be seen as the end of the stream
+			err = ctx.Err()
+		}
+		if err != nil {
+			g.logger.Debug("Event stream stopped with an error", zap.String("conversation-id", conversationId), zap.Error(err))
+			errorEvent := StreamEvent{Type: StreamEventError, Err: err, ConversationID: conversationId}
+			if ctx.Err() == nil {
+				_ = send(errorEvent)
+				return
+			}
+			// Use a non-blocking send as the receiver may have stopped reading after the cancellation
+			select {
+			case events <- errorEvent:
+			default:
+			}
+			return
+		}
+		if last != nil {
+			if send(StreamEvent{Type: StreamEventMessage, Text: last.Text, Response: last, ConversationID: conversationId}) != nil {
+				return
+			}
+		}
+		_ = send(StreamEvent{Type: StreamEventDone, ConversationID: conversationId})
+	}()
+	return events, nil
+}
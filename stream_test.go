@@ -0,0 +1,126 @@
+package gogpt_test
+
+import (
+	"context"
+	"github.com/Makepad-fr/gogpt"
+	"github.com/Makepad-fr/gogpt/gogpttest"
+	"strings"
+	"testing"
+)
+
+// chunksResponder returns a gogpttest.Responder replying with the given chunks
+func chunksResponder(chunks ...string) gogpttest.Responder {
+	return func(action, prompt string) gogpttest.Reply {
+		return gogpttest.Reply{Chunks: chunks}
+	}
+}
+
+func TestCreateConversationHandlesTheEvents(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetResponder(chunksResponder("Hello", ", ", "world"))
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	var deltas []string
+	var last gogpt.ConversationResponse
+	conversation, err := gpt.CreateConversation("hi", gogpttest.DefaultModel, func(response gogpt.ConversationResponse) {
+		if len(response.Delta) > 0 {
+			deltas = append(deltas, response.Delta)
+		}
+		last = response
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation returned an error: %v", err)
+	}
+	if got := strings.Join(deltas, "|"); got != "Hello|, |world" {
+		t.Errorf("deltas = %q, want %q", got, "Hello|, |world")
+	}
+	if last.Text != "Hello, world" || last.ConversationID != conversation.ID || last.IsTruncated() {
+		t.Errorf("last response = %+v, want the complete message of the conversation", last)
+	}
+	if stored, ok := srv.Conversation(conversation.ID); !ok || len(stored.ActiveThread()) != 2 {
+		t.Errorf("the conversation is not stored by the server")
+	}
+}
+
+func TestSendMessageAutoContinuesTruncatedResponses(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetResponder(func(action, prompt string) gogpttest.Reply {
+		if action == "continue" {
+			return gogpttest.Reply{Chunks: []string{" end"}}
+		}
+		return gogpttest.Reply{Chunks: []string{"start"}, Truncated: true}
+	})
+	options := testOptions(srv)
+	options.AutoContinue = 1
+	gpt := newLoggedInGPT(t, options)
+
+	var last gogpt.ConversationResponse
+	_, err := gpt.CreateConversation("hi", gogpttest.DefaultModel, func(response gogpt.ConversationResponse) {
+		last = response
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation returned an error: %v", err)
+	}
+	if last.Text != "start end" || last.IsTruncated() {
+		t.Errorf("last response text = %q, truncated %v, want the continued message", last.Text, last.IsTruncated())
+	}
+}
+
+func TestCreateConversationStreamSendsTheEvents(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetResponder(chunksResponder("a", "b", "c"))
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	events, err := gpt.CreateConversationStream(context.Background(), "hi", gogpttest.DefaultModel)
+	if err != nil {
+		t.Fatalf("CreateConversationStream returned an error: %v", err)
+	}
+	var types []gogpt.StreamEventType
+	var text string
+	for event := range events {
+		types = append(types, event.Type)
+		switch event.Type {
+		case gogpt.StreamEventDelta:
+			text += event.Delta
+		case gogpt.StreamEventMessage:
+			if event.Text != "abc" {
+				t.Errorf("message text = %q, want %q", event.Text, "abc")
+			}
+		case gogpt.StreamEventError:
+			t.Fatalf("unexpected error event: %v", event.Err)
+		}
+	}
+	if text != "abc" {
+		t.Errorf("text of the deltas = %q, want %q", text, "abc")
+	}
+	want := []gogpt.StreamEventType{
+		gogpt.StreamEventDelta, gogpt.StreamEventDelta, gogpt.StreamEventDelta, gogpt.StreamEventMessage, gogpt.StreamEventDone,
+	}
+	if len(types) != len(want) {
+		t.Fatalf("event types = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("event types = %v, want %v", types, want)
+		}
+	}
+}
+
+func TestCreateConversationStreamStopsOnCancellation(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetResponder(chunksResponder("a", "b", "c"))
+	gpt := newLoggedInGPT(t, testOptions(srv))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := gpt.CreateConversationStream(ctx, "hi", gogpttest.DefaultModel)
+	if err != nil {
+		t.Fatalf("CreateConversationStream returned an error: %v", err)
+	}
+	cancel()
+	// The channel is closed even if the events are not read after the cancellation
+	for event := range events {
+		if event.Type == gogpt.StreamEventDone {
+			t.Log("the stream ended before the cancellation")
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package gogpt
 
-import "strings"
+import (
+	"strings"
+	"unicode/utf8"
+)
 
 // isEmpty checks if the given string is empty or not by trimming it using strings.TrimSpace
 func isEmpty(input string) bool {
@@ -11,3 +14,27 @@ func isEmpty(input string) bool {
 func isEndOfEventStream(input string) bool {
 	return strings.HasPrefix(input, "data: [DONE]")
 }
+
+// joinParts returns the text of the given content parts as a single string
+func joinParts(parts []string) string {
+	return strings.Join(parts, "")
+}
+
+// textDelta computes the text added by current compared to previous. Most of the time current extends previous and
+// the added text is simply the suffix of current. Otherwise, the longest common prefix of both strings is used, and
+// replaced is the number of runes at the end of previous which are replaced by the added text. The common prefix never
+// ends in the middle of a multibyte UTF-8 sequence
+func textDelta(previous, current string) (added string, replaced int) {
+	if strings.HasPrefix(current, previous) {
+		return current[len(previous):], 0
+	}
+	i := 0
+	for i < len(previous) && i < len(current) && previous[i] == current[i] {
+		i++
+	}
+	// Move back to the beginning of the rune if the common prefix ends in the middle of it
+	for i > 0 && i < len(current) && !utf8.RuneStart(current[i]) {
+		i--
+	}
+	return current[i:], utf8.RuneCountInString(previous[i:])
+}
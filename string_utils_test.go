@@ -0,0 +1,55 @@
+package gogpt
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+// applyDelta replaces the last replaced runes of previous with added, as a consumer of the deltas does
+func applyDelta(previous, added string, replaced int) string {
+	runes := []rune(previous)
+	return string(runes[:len(runes)-replaced]) + added
+}
+
+func TestTextDelta(t *testing.T) {
+	tests := []struct {
+		name         string
+		previous     []string
+		current      []string
+		wantAdded    string
+		wantReplaced int
+	}{
+		{"first delta", nil, []string{"Hello"}, "Hello", 0},
+		{"plain append", []string{"Hello"}, []string{"Hello, world"}, ", world", 0},
+		{"no change", []string{"Hello"}, []string{"Hello"}, "", 0},
+		{"rewrite of earlier text", []string{"Hello wrld"}, []string{"Hello world!"}, "orld!", 3},
+		{"complete rewrite", []string{"abc"}, []string{"xyz"}, "xyz", 3},
+		{"shortened text", []string{"Hello world"}, []string{"Hello"}, "", 6},
+		{"append after a multibyte rune", []string{"caf"}, []string{"café"}, "é", 0},
+		// é and è share their first byte
+		{"split inside a multibyte rune", []string{"café"}, []string{"cafè!"}, "è!", 1},
+		// 😀 and 😁 share their first three bytes
+		{"split inside an emoji", []string{"ok 😀"}, []string{"ok 😁"}, "😁", 1},
+		// The variation selector of the heart is a separate rune
+		{"emoji with a variation selector", []string{"I \u2764\ufe0f"}, []string{"I 👍"}, "👍", 2},
+		{"combining characters", []string{"e\u0301"}, []string{"e\u0300 "}, "\u0300 ", 1},
+		{"appended combining character", []string{"e"}, []string{"e\u0301"}, "\u0301", 0},
+		{"multi-part content", []string{"Hello", ", "}, []string{"Hello", ", ", "world"}, "world", 0},
+		{"multi-part rewrite", []string{"Hello", ", wrld"}, []string{"Hello", ", world"}, "orld", 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous, current := joinParts(test.previous), joinParts(test.current)
+			added, replaced := textDelta(previous, current)
+			if added != test.wantAdded || replaced != test.wantReplaced {
+				t.Errorf("textDelta(%q, %q) = %q, %d, want %q, %d", previous, current, added, replaced, test.wantAdded, test.wantReplaced)
+			}
+			if !utf8.ValidString(added) {
+				t.Errorf("added text %q is not valid UTF-8", added)
+			}
+			if got := applyDelta(previous, added, replaced); got != current {
+				t.Errorf("applying the delta to %q gives %q, want %q", previous, got, current)
+			}
+		})
+	}
+}
@@ -1,13 +1,16 @@
 package gogpt
 
 import (
+	"context"
 	"github.com/playwright-community/playwright-go"
+	"math"
 	"math/rand"
 	"net/http"
 	"time"
 )
 
-const baseURL = "https://chat.openai.com"
+// defaultBaseURL is the URL of ChatGPT used if there is no BaseURL in Options
+const defaultBaseURL = "https://chat.openai.com"
 
 // randomTimeOut returns a random float64 value used as a timeout between 1000 and 10,000
 func randomTimeOut() float64 {
@@ -15,28 +18,80 @@ func randomTimeOut() float64 {
 	return float64(r.Intn(10000) + 1000)
 }
 
+// sleepContext pauses the current goroutine for the given duration or until the given context.Context is done.
+// It returns the error of the context if it is done before the end of the duration
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// playwrightTimeout returns the timeout in milliseconds to use for a playwright operation with the given
+// context.Context. If the context has a deadline, it returns the smallest value between the given timeout and the
+// remaining time before the deadline. Otherwise, it returns the given timeout
+func playwrightTimeout(ctx context.Context, timeout *float64) *float64 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return timeout
+	}
+	// A timeout of 0 disables the timeout in playwright, so the minimum value is 1ms
+	remaining := math.Max(float64(time.Until(deadline).Milliseconds()), 1)
+	if timeout != nil && *timeout < remaining {
+		return timeout
+	}
+	return &remaining
+}
+
 // playwrightSameSiteAttributeToHttpSameSite converts a *playwright.SameSiteAttribute to a http.SameSite
 func playwrightSameSiteAttributeToHttpSameSite(attribute *playwright.SameSiteAttribute) http.SameSite {
-	switch attribute {
-	case playwright.SameSiteAttributeStrict:
+	if attribute == nil {
+		return http.SameSiteDefaultMode
+	}
+	switch *attribute {
+	case *playwright.SameSiteAttributeStrict:
 		return http.SameSiteStrictMode
-	case playwright.SameSiteAttributeLax:
+	case *playwright.SameSiteAttributeLax:
 		return http.SameSiteLaxMode
-	case playwright.SameSiteAttributeNone:
+	case *playwright.SameSiteAttributeNone:
 		return http.SameSiteNoneMode
 	default:
 		return http.SameSiteDefaultMode
 	}
 }
 
-// playwrightToHttpCookie converts the given *playwright.BrowserContextCookiesResult to a *http.Cookie
+// httpSameSiteToPlaywrightSameSiteAttribute converts a http.SameSite to a *playwright.SameSiteAttribute. It returns
+// nil for http.SameSiteDefaultMode
+func httpSameSiteToPlaywrightSameSiteAttribute(sameSite http.SameSite) *playwright.SameSiteAttribute {
+	switch sameSite {
+	case http.SameSiteStrictMode:
+		return playwright.SameSiteAttributeStrict
+	case http.SameSiteLaxMode:
+		return playwright.SameSiteAttributeLax
+	case http.SameSiteNoneMode:
+		return playwright.SameSiteAttributeNone
+	default:
+		return nil
+	}
+}
+
+// playwrightToHttpCookie converts the given *playwright.BrowserContextCookiesResult to a *http.Cookie. The session
+// cookies, which have a negative or zero expiration time in playwright, have a zero Expires
 func playwrightToHttpCookie(playwrightCookie *playwright.BrowserContextCookiesResult) *http.Cookie {
+	var expires time.Time
+	if playwrightCookie.Expires > 0 {
+		expires = time.Unix(int64(playwrightCookie.Expires), 0)
+	}
 	return &http.Cookie{
 		Name:     playwrightCookie.Name,
 		Value:    playwrightCookie.Value,
 		Path:     playwrightCookie.Path,
 		Domain:   playwrightCookie.Domain,
-		Expires:  time.Unix(int64(playwrightCookie.Expires), 0),
+		Expires:  expires,
 		Secure:   playwrightCookie.Secure,
 		HttpOnly: playwrightCookie.HttpOnly,
 		SameSite: playwrightSameSiteAttributeToHttpSameSite(&playwrightCookie.SameSite),
@@ -1,5 +1,10 @@
 package gogpt
 
+import (
+	"errors"
+	"fmt"
+)
+
 type Version int64
 
 const (
@@ -7,3 +12,39 @@ const (
 	V3_5     Version = 1
 	V3Legacy Version = 2
 )
+
+// ErrPaidSubscriptionRequired is returned when the requested Version is only available with an active paid subscription
+var ErrPaidSubscriptionRequired = errors.New("an active paid subscription is required")
+
+// String returns the human-readable name of the Version
+func (v Version) String() string {
+	switch v {
+	case V4:
+		return "GPT-4"
+	case V3_5:
+		return "GPT-3.5"
+	case V3Legacy:
+		return "GPT-3.5 (Legacy)"
+	default:
+		return fmt.Sprintf("Version(%d)", int64(v))
+	}
+}
+
+// modelSlugs returns the model slugs that can be used for the Version, ordered by preference
+func (v Version) modelSlugs() []string {
+	switch v {
+	case V4:
+		return []string{"gpt-4", "gpt-4-browsing", "gpt-4-plugins"}
+	case V3_5:
+		return []string{"text-davinci-002-render-sha"}
+	case V3Legacy:
+		return []string{"text-davinci-002-render-paid"}
+	default:
+		return nil
+	}
+}
+
+// requiresPaidSubscription returns true if the Version is only available with an active paid subscription
+func (v Version) requiresPaidSubscription() bool {
+	return v == V4 || v == V3Legacy
+}